@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/Swarmind/libagent/pkg/config"
+	_ "github.com/Swarmind/libagent/pkg/logging"
+	"github.com/Swarmind/libagent/pkg/tools"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rs/zerolog/log"
+)
+
+/*
+	Serves the libagent tools as an MCP server over stdio, or over streamable HTTP with the -http flag.
+	The tools are configured with the usual LIBAGENT_ variables and can be whitelisted with the -tools flag.
+*/
+
+func main() {
+	httpAddr := flag.String("http", "", "serve over streamable HTTP on the address, e.g. :8080, instead of stdio")
+	toolsList := flag.String("tools", "", "comma separated tools whitelist, all the configured tools if empty")
+	flag.Parse()
+
+	cfg, err := config.NewConfig()
+	if err != nil {
+		log.Fatal().Err(err).Msg("new config")
+	}
+
+	opts := []tools.ExecutorOption{}
+	if *toolsList != "" {
+		opts = append(opts, tools.WithToolsWhitelist(strings.Split(*toolsList, ",")...))
+	}
+	newExecutor := func(ctx context.Context) (*tools.ToolsExecutor, error) {
+		return tools.NewToolsExecutor(ctx, cfg, opts...)
+	}
+
+	defer func() {
+		if err := tools.CloseConfigAuditLogs(); err != nil {
+			log.Warn().Err(err).Msg("close audit logs")
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if *httpAddr == "" {
+		toolsExecutor, err := newExecutor(ctx)
+		if err != nil {
+			log.Fatal().Err(err).Msg("new tools executor")
+		}
+		if err := tools.ServeMCPStdio(ctx, toolsExecutor); err != nil && !errors.Is(err, context.Canceled) {
+			log.Fatal().Err(err).Msg("serve mcp stdio")
+		}
+		return
+	}
+
+	server := &http.Server{
+		Addr:    *httpAddr,
+		Handler: tools.NewMCPHandler(ctx, newExecutor, &mcp.StreamableHTTPOptions{}),
+	}
+	go func() {
+		<-ctx.Done()
+		if err := server.Shutdown(context.Background()); err != nil {
+			log.Warn().Err(err).Msg("http server shutdown")
+		}
+	}()
+	log.Info().Msgf("serving mcp on %s", *httpAddr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal().Err(err).Msg("serve mcp http")
+	}
+}
@@ -53,6 +53,11 @@ func main() {
 		log.Fatal().Err(err).Msg("new tools executor")
 	}
 	agent.ToolsExecutor = toolsExecutor
+	// nil unless LIBAGENT_TOOL_SELECTION_TOP_K is set
+	agent.ToolSelector, err = tools.NewToolSelector(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("new tool selector")
+	}
 	defer func() {
 		if err := toolsExecutor.Cleanup(); err != nil {
 			log.Fatal().Err(err).Msg("tools executor cleanup")
@@ -0,0 +1,54 @@
+#!/usr/bin/env python3
+"""RPC mode plugin: a long-lived process serving the JSON-RPC calls a line each."""
+import hashlib
+import json
+import sys
+
+DESCRIPTION = {
+    "mode": "rpc",
+    "tools": [
+        {
+            "name": "hashText",
+            "description": "Returns the hex digest of the text.",
+            "parameters": {
+                "type": "object",
+                "properties": {
+                    "text": {"type": "string"},
+                    "algorithm": {"type": "string", "enum": ["md5", "sha1", "sha256"], "default": "sha256"},
+                },
+                "required": ["text"],
+            },
+        },
+    ],
+}
+
+
+def call(name, args):
+    if name != "hashText":
+        raise ValueError(f"unknown tool {name}")
+    algorithm = args.get("algorithm", "sha256")
+    return hashlib.new(algorithm, args["text"].encode()).hexdigest()
+
+
+def serve():
+    for line in sys.stdin:
+        request = json.loads(line)
+        response = {"jsonrpc": "2.0", "id": request["id"]}
+        try:
+            params = request["params"]
+            response["result"] = call(params["name"], params["arguments"])
+        except Exception as e:
+            print(f"call failed: {e}", file=sys.stderr)
+            response["error"] = {"code": -32000, "message": str(e)}
+        print(json.dumps(response), flush=True)
+
+
+if __name__ == "__main__":
+    command = sys.argv[1] if len(sys.argv) > 1 else ""
+    if command == "describe":
+        print(json.dumps(DESCRIPTION))
+    elif command == "serve":
+        serve()
+    else:
+        print(f"unknown command {command!r}", file=sys.stderr)
+        sys.exit(2)
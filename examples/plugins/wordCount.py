@@ -0,0 +1,29 @@
+#!/usr/bin/env python3
+"""Exec mode plugin: run once per call with the arguments JSON on stdin."""
+import json
+import sys
+
+DESCRIPTION = {
+    "name": "wordCount",
+    "description": "Counts the words and lines of the text.",
+    "parameters": {
+        "type": "object",
+        "properties": {
+            "text": {"type": "string", "description": "The text to count"},
+        },
+        "required": ["text"],
+    },
+    "examples": [{"arguments": {"text": "hello world"}}],
+}
+
+if __name__ == "__main__":
+    command = sys.argv[1] if len(sys.argv) > 1 else ""
+    if command == "describe":
+        print(json.dumps(DESCRIPTION))
+    elif command == "call":
+        args = json.load(sys.stdin)
+        text = args["text"]
+        print(json.dumps({"words": len(text.split()), "lines": len(text.splitlines())}))
+    else:
+        print(f"unknown command {command!r}", file=sys.stderr)
+        sys.exit(2)
@@ -0,0 +1,377 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// Approval decisions of the audited calls.
+const (
+	// AuditDecisionAllowed is the call which did not require an approval.
+	AuditDecisionAllowed  = "allowed"
+	AuditDecisionApproved = "approved"
+	AuditDecisionDenied   = "denied"
+)
+
+const DefaultAuditTable = "tool_audit_log"
+
+// AuditRecord is a tool call record. Hash is the SHA-256 of the record JSON with the empty hash,
+// which includes the previous record hash, so a modified, removed or inserted record breaks the chain.
+type AuditRecord struct {
+	Sequence   int64         `json:"sequence"`
+	Timestamp  time.Time     `json:"timestamp"`
+	SessionID  string        `json:"session_id"`
+	RunID      string        `json:"run_id,omitempty"`
+	Tool       string        `json:"tool"`
+	Arguments  string        `json:"arguments"`
+	ResultHash string        `json:"result_hash,omitempty"`
+	ResultSize int           `json:"result_size"`
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration"`
+	Decision   string        `json:"decision"`
+	PrevHash   string        `json:"prev_hash"`
+	Hash       string        `json:"hash"`
+}
+
+func (r AuditRecord) computeHash() (string, error) {
+	r.Hash = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AuditSink stores the audit records, Last returns the last stored record to continue the chain, nil if none.
+type AuditSink interface {
+	Append(ctx context.Context, record AuditRecord) error
+	Last(ctx context.Context) (*AuditRecord, error)
+}
+
+// AuditLog chains and appends the records to the sink. A log should be the only writer of its sink,
+// so it is shared between the executors writing to the same sink.
+type AuditLog struct {
+	Sink AuditSink
+	// SessionID is set on every record, a random one if empty.
+	SessionID string
+
+	mu       sync.Mutex
+	loaded   bool
+	sequence int64
+	prevHash string
+}
+
+func NewAuditLog(sink AuditSink) *AuditLog {
+	return &AuditLog{
+		Sink:      sink,
+		SessionID: uuid.New().String(),
+	}
+}
+
+// Append chains the record to the previous one and appends it to the sink.
+func (l *AuditLog) Append(ctx context.Context, record AuditRecord) (AuditRecord, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.loaded {
+		if l.SessionID == "" {
+			l.SessionID = uuid.New().String()
+		}
+		last, err := l.Sink.Last(ctx)
+		if err != nil {
+			return record, fmt.Errorf("audit log last record: %w", err)
+		}
+		if last != nil {
+			l.sequence, l.prevHash = last.Sequence, last.Hash
+		}
+		l.loaded = true
+	}
+
+	record.Sequence = l.sequence + 1
+	// Stored with microsecond precision by Postgres, so truncated to keep the hash verifiable
+	record.Timestamp = record.Timestamp.UTC().Truncate(time.Microsecond)
+	record.SessionID = l.SessionID
+	record.PrevHash = l.prevHash
+	hash, err := record.computeHash()
+	if err != nil {
+		return record, fmt.Errorf("audit record hash: %w", err)
+	}
+	record.Hash = hash
+
+	if err := l.Sink.Append(ctx, record); err != nil {
+		// The chain is reloaded on the next append, as the failure may be caused by another sink writer
+		l.loaded = false
+		return record, fmt.Errorf("audit log append: %w", err)
+	}
+	l.sequence, l.prevHash = record.Sequence, record.Hash
+	return record, nil
+}
+
+// VerifyAuditRecords checks the records hashes and chain links, the records are expected in the sequence order.
+func VerifyAuditRecords(records []AuditRecord) error {
+	for idx, record := range records {
+		hash, err := record.computeHash()
+		if err != nil {
+			return fmt.Errorf("record %d hash: %w", record.Sequence, err)
+		}
+		if hash != record.Hash {
+			return fmt.Errorf("record %d is modified: hash mismatch", record.Sequence)
+		}
+		if idx == 0 {
+			continue
+		}
+		prev := records[idx-1]
+		if record.PrevHash != prev.Hash || record.Sequence != prev.Sequence+1 {
+			return fmt.Errorf("record %d is not chained to the record %d", record.Sequence, prev.Sequence)
+		}
+	}
+	return nil
+}
+
+type runIDKey struct{}
+
+// ContextWithRunID sets the run ID recorded in the audit records of the calls made with the context.
+func ContextWithRunID(ctx context.Context, runID string) context.Context {
+	return context.WithValue(ctx, runIDKey{}, runID)
+}
+
+func RunIDFromContext(ctx context.Context) string {
+	runID, _ := ctx.Value(runIDKey{}).(string)
+	return runID
+}
+
+// audit records the finished call, the audit failure is logged as it can not affect the executed call.
+func (e *ToolsExecutor) audit(
+	ctx context.Context, toolName, args, decision string,
+	start time.Time, content string, callErr error,
+) {
+	if e.Audit == nil {
+		return
+	}
+
+	record := AuditRecord{
+		Timestamp: start,
+		RunID:     RunIDFromContext(ctx),
+		Tool:      toolName,
+		Arguments: args,
+		Duration:  time.Since(start),
+		Decision:  decision,
+	}
+	if callErr != nil {
+		record.Error = callErr.Error()
+	} else {
+		sum := sha256.Sum256([]byte(content))
+		record.ResultHash = hex.EncodeToString(sum[:])
+		record.ResultSize = len(content)
+	}
+
+	// The record is kept even if the call context is canceled
+	if _, err := e.Audit.Append(context.WithoutCancel(ctx), record); err != nil {
+		log.Error().Err(err).Msgf("Tool %s call audit", toolName)
+	}
+}
+
+// JSONLAuditSink appends the records as JSON lines to the file, syncing it after every record.
+type JSONLAuditSink struct {
+	Path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+func (s *JSONLAuditSink) Append(ctx context.Context, record AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		file, err := os.OpenFile(s.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return err
+		}
+		s.file = file
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+func (s *JSONLAuditSink) Last(ctx context.Context) (*AuditRecord, error) {
+	records, err := ReadJSONLAudit(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return &records[len(records)-1], nil
+}
+
+func (s *JSONLAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// ReadJSONLAudit reads the records of the JSONL audit file.
+func ReadJSONLAudit(path string) ([]AuditRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records := []AuditRecord{}
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if len(data) > 0 {
+			record := AuditRecord{}
+			if err := json.Unmarshal(data, &record); err != nil {
+				return nil, fmt.Errorf("audit file line %d: %w", line, err)
+			}
+			records = append(records, record)
+		}
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// PostgresAuditSink inserts the records into the table, created if it does not exist.
+type PostgresAuditSink struct {
+	Pool  *pgxpool.Pool
+	Table string
+
+	// ready is set once the table is created, the failed creation is retried on the next use
+	mu    sync.Mutex
+	ready bool
+}
+
+func (s *PostgresAuditSink) table() string {
+	table := s.Table
+	if table == "" {
+		table = DefaultAuditTable
+	}
+	return pgx.Identifier{table}.Sanitize()
+}
+
+func (s *PostgresAuditSink) init(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ready {
+		return nil
+	}
+	_, err := s.Pool.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	sequence BIGINT PRIMARY KEY,
+	timestamp TIMESTAMPTZ NOT NULL,
+	session_id TEXT NOT NULL,
+	run_id TEXT NOT NULL,
+	tool TEXT NOT NULL,
+	arguments TEXT NOT NULL,
+	result_hash TEXT NOT NULL,
+	result_size INTEGER NOT NULL,
+	error TEXT NOT NULL,
+	duration BIGINT NOT NULL,
+	decision TEXT NOT NULL,
+	prev_hash TEXT NOT NULL,
+	hash TEXT NOT NULL UNIQUE
+)`, s.table()))
+	if err != nil {
+		return fmt.Errorf("create audit table: %w", err)
+	}
+	s.ready = true
+	return nil
+}
+
+func (s *PostgresAuditSink) Append(ctx context.Context, record AuditRecord) error {
+	if err := s.init(ctx); err != nil {
+		return err
+	}
+	_, err := s.Pool.Exec(ctx, fmt.Sprintf(`INSERT INTO %s (
+	sequence, timestamp, session_id, run_id, tool, arguments, result_hash,
+	result_size, error, duration, decision, prev_hash, hash
+) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`, s.table()),
+		record.Sequence, record.Timestamp, record.SessionID, record.RunID, record.Tool, record.Arguments,
+		record.ResultHash, record.ResultSize, record.Error, int64(record.Duration), record.Decision,
+		record.PrevHash, record.Hash,
+	)
+	return err
+}
+
+func (s *PostgresAuditSink) Last(ctx context.Context) (*AuditRecord, error) {
+	records, err := s.Records(ctx, 1, true)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return &records[0], nil
+}
+
+// Records returns the records in the sequence order, the last ones if reverse, limited if limit is positive.
+func (s *PostgresAuditSink) Records(ctx context.Context, limit int, reverse bool) ([]AuditRecord, error) {
+	if err := s.init(ctx); err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf(`SELECT
+	sequence, timestamp, session_id, run_id, tool, arguments, result_hash,
+	result_size, error, duration, decision, prev_hash, hash
+FROM %s ORDER BY sequence`, s.table())
+	if reverse {
+		query += " DESC"
+	}
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	rows, err := s.Pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []AuditRecord{}
+	for rows.Next() {
+		record := AuditRecord{}
+		var duration int64
+		if err := rows.Scan(
+			&record.Sequence, &record.Timestamp, &record.SessionID, &record.RunID, &record.Tool,
+			&record.Arguments, &record.ResultHash, &record.ResultSize, &record.Error, &duration,
+			&record.Decision, &record.PrevHash, &record.Hash,
+		); err != nil {
+			return nil, err
+		}
+		record.Timestamp = record.Timestamp.UTC()
+		record.Duration = time.Duration(duration)
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,283 @@
+package tools
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CacheBackend stores the tool results by the key until the expiration.
+type CacheBackend interface {
+	Get(ctx context.Context, key string) (string, bool, error)
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+}
+
+type CacheStats struct {
+	Hits   int64
+	Misses int64
+	// Bypassed are the calls made with ContextWithoutCache.
+	Bypassed int64
+	Stores   int64
+	Errors   int64
+}
+
+// ToolCache caches the successful results of the tools with the positive policy CacheTTL,
+// keyed by the tool name and the normalized arguments.
+type ToolCache struct {
+	Backend CacheBackend
+
+	mu    sync.Mutex
+	stats map[string]*CacheStats
+}
+
+func NewToolCache(backend CacheBackend) *ToolCache {
+	return &ToolCache{Backend: backend}
+}
+
+// Stats returns the statistics summed over the tools.
+func (c *ToolCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	total := CacheStats{}
+	for _, stats := range c.stats {
+		total.Hits += stats.Hits
+		total.Misses += stats.Misses
+		total.Bypassed += stats.Bypassed
+		total.Stores += stats.Stores
+		total.Errors += stats.Errors
+	}
+	return total
+}
+
+// ToolStats returns the statistics by the tool name.
+func (c *ToolCache) ToolStats() map[string]CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	toolStats := map[string]CacheStats{}
+	for name, stats := range c.stats {
+		toolStats[name] = *stats
+	}
+	return toolStats
+}
+
+func (c *ToolCache) count(toolName string, f func(*CacheStats)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stats == nil {
+		c.stats = map[string]*CacheStats{}
+	}
+	stats, ok := c.stats[toolName]
+	if !ok {
+		stats = &CacheStats{}
+		c.stats[toolName] = stats
+	}
+	f(stats)
+}
+
+// CacheKey is the hash of the tool name and the arguments JSON normalized by the keys order and formatting.
+func CacheKey(toolName, args string) string {
+	normalized := []byte(args)
+	decoder := json.NewDecoder(bytes.NewReader(normalized))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err == nil {
+		if data, err := json.Marshal(value); err == nil {
+			normalized = data
+		}
+	}
+	sum := sha256.Sum256(append([]byte(toolName+"\x00"), normalized...))
+	return hex.EncodeToString(sum[:])
+}
+
+type noCacheKey struct{}
+
+// ContextWithoutCache bypasses the cached results for the calls made with the context,
+// their fresh results still replace the cached ones.
+func ContextWithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+func cacheBypassed(ctx context.Context) bool {
+	bypassed, _ := ctx.Value(noCacheKey{}).(bool)
+	return bypassed
+}
+
+// callCached returns the cached result of the call or calls the tool, caching its successful result.
+// The cache failures are logged and counted, falling back to the call.
+func (e *ToolsExecutor) callCached(ctx context.Context, toolData *ToolData, args string) (string, error) {
+	name := toolData.Definition.Name
+	ttl := e.policy(name).CacheTTL
+	if e.Cache == nil || e.Cache.Backend == nil || ttl <= 0 {
+		return e.callInitialized(ctx, toolData, args)
+	}
+
+	key := CacheKey(name, args)
+	if cacheBypassed(ctx) {
+		e.Cache.count(name, func(s *CacheStats) { s.Bypassed++ })
+	} else {
+		content, ok, err := e.Cache.Backend.Get(ctx, key)
+		switch {
+		case err != nil:
+			log.Warn().Err(err).Msgf("Tool %s cache get", name)
+			e.Cache.count(name, func(s *CacheStats) { s.Errors++ })
+		case ok:
+			e.Cache.count(name, func(s *CacheStats) { s.Hits++ })
+			return content, nil
+		default:
+			e.Cache.count(name, func(s *CacheStats) { s.Misses++ })
+		}
+	}
+
+	content, err := e.callInitialized(ctx, toolData, args)
+	if err != nil {
+		return content, err
+	}
+	if err := e.Cache.Backend.Set(ctx, key, content, ttl); err != nil {
+		log.Warn().Err(err).Msgf("Tool %s cache set", name)
+		e.Cache.count(name, func(s *CacheStats) { s.Errors++ })
+	} else {
+		e.Cache.count(name, func(s *CacheStats) { s.Stores++ })
+	}
+	return content, nil
+}
+
+// MemoryCache is the in-memory LRU cache of at most MaxEntries results (unlimited if not positive).
+type MemoryCache struct {
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type memoryCacheEntry struct {
+	key     string
+	value   string
+	expires time.Time
+}
+
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{MaxEntries: maxEntries}
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string) (string, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return "", false, nil
+	}
+	entry := element.Value.(*memoryCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return "", false, nil
+	}
+	c.order.MoveToFront(element)
+	return entry.value, true, nil
+}
+
+func (c *MemoryCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = map[string]*list.Element{}
+		c.order = list.New()
+	}
+	entry := &memoryCacheEntry{key: key, value: value, expires: time.Now().Add(ttl)}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.MaxEntries > 0 && c.order.Len() > c.MaxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryCacheEntry).key)
+	}
+	return nil
+}
+
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// DiskCache stores the results as JSON files in the Dir, so they are kept between the runs.
+// The expired files are removed on read.
+type DiskCache struct {
+	Dir string
+}
+
+type diskCacheEntry struct {
+	Expires time.Time `json:"expires"`
+	Value   string    `json:"value"`
+}
+
+func (c DiskCache) path(key string) string {
+	return filepath.Join(c.Dir, key+".json")
+}
+
+func (c DiskCache) Get(ctx context.Context, key string) (string, bool, error) {
+	data, err := os.ReadFile(c.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	entry := diskCacheEntry{}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return "", false, fmt.Errorf("cache entry %s: %w", key, err)
+	}
+	if time.Now().After(entry.Expires) {
+		if err := os.Remove(c.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", false, err
+		}
+		return "", false, nil
+	}
+	return entry.Value, true, nil
+}
+
+func (c DiskCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	if err := os.MkdirAll(c.Dir, 0o700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(diskCacheEntry{Expires: time.Now().Add(ttl), Value: value})
+	if err != nil {
+		return err
+	}
+	// Written to a temp file and renamed, so the concurrent readers never see a partial entry
+	file, err := os.CreateTemp(c.Dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), c.path(key))
+}
@@ -0,0 +1,352 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrCallDenied = errors.New("tool call denied by policy")
+
+type CallAction string
+
+const (
+	CallAllow   CallAction = "allow"
+	CallDeny    CallAction = "deny"
+	CallApprove CallAction = "approve"
+)
+
+// Dry run decisions of the audited calls, which would be denied or require an approval.
+const (
+	AuditDecisionDryRunDenied   = "dry_run_denied"
+	AuditDecisionDryRunApproval = "dry_run_approval"
+)
+
+// CallPolicy is the declarative policy evaluated before every tool call.
+// The first rule matching the call decides its action, the Default one (allow if empty) applies otherwise.
+// In the DryRun mode the violations are only logged.
+type CallPolicy struct {
+	Default CallAction `yaml:"default" json:"default"`
+	DryRun  bool       `yaml:"dry_run" json:"dry_run"`
+	Rules   []CallRule `yaml:"rules" json:"rules"`
+}
+
+// CallRule matches the calls of the Tools (path.Match patterns, every tool if empty)
+// for which all the Conditions match.
+type CallRule struct {
+	Name       string          `yaml:"name" json:"name"`
+	Tools      []string        `yaml:"tools" json:"tools"`
+	Conditions []CallCondition `yaml:"conditions" json:"conditions"`
+	Action     CallAction      `yaml:"action" json:"action"`
+	// Message is returned to the model along with the denial.
+	Message string `yaml:"message" json:"message"`
+}
+
+// CallCondition matches the Argument (dot separated path, the whole arguments JSON if empty) values
+// by one of Regex, CIDRs or Domains. An array argument matches if any of its values does,
+// Negate inverts the match of every value, e.g. a negated CIDRs list matches a host out of them.
+type CallCondition struct {
+	Argument string   `yaml:"argument" json:"argument"`
+	Regex    string   `yaml:"regex" json:"regex"`
+	CIDRs    []string `yaml:"cidrs" json:"cidrs"`
+	Domains  []string `yaml:"domains" json:"domains"`
+	Negate   bool     `yaml:"negate" json:"negate"`
+
+	regex    *regexp.Regexp
+	prefixes []netip.Prefix
+}
+
+// LoadCallPolicy reads the YAML or JSON policy file.
+func LoadCallPolicy(path string) (*CallPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read call policy: %w", err)
+	}
+	policy := &CallPolicy{}
+	if err := yaml.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("parse call policy: %w", err)
+	}
+	if err := policy.Compile(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// Clone copies the policy with its rules and conditions, so the copy can be compiled and changed independently.
+func (p *CallPolicy) Clone() *CallPolicy {
+	clone := *p
+	clone.Rules = slices.Clone(p.Rules)
+	for idx := range clone.Rules {
+		clone.Rules[idx].Conditions = slices.Clone(clone.Rules[idx].Conditions)
+	}
+	return &clone
+}
+
+// Compile validates the policy and prepares its matchers, it is required for the policies built in code.
+func (p *CallPolicy) Compile() error {
+	if err := validateAction(p.Default, true); err != nil {
+		return fmt.Errorf("call policy default: %w", err)
+	}
+	for ruleIdx := range p.Rules {
+		rule := &p.Rules[ruleIdx]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("#%d", ruleIdx+1)
+		}
+		if err := validateAction(rule.Action, false); err != nil {
+			return fmt.Errorf("call policy rule %s: %w", rule.Name, err)
+		}
+		for _, pattern := range rule.Tools {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("call policy rule %s tool pattern %q: %w", rule.Name, pattern, err)
+			}
+		}
+		for condIdx := range rule.Conditions {
+			if err := rule.Conditions[condIdx].compile(); err != nil {
+				return fmt.Errorf("call policy rule %s condition #%d: %w", rule.Name, condIdx+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validateAction(action CallAction, allowEmpty bool) error {
+	switch action {
+	case CallAllow, CallDeny, CallApprove:
+		return nil
+	case "":
+		if allowEmpty {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown action %q, expected allow, deny or approve", action)
+}
+
+func (c *CallCondition) compile() error {
+	matchers := 0
+	if c.Regex != "" {
+		regex, err := regexp.Compile(c.Regex)
+		if err != nil {
+			return fmt.Errorf("regex: %w", err)
+		}
+		c.regex = regex
+		matchers++
+	}
+	if len(c.CIDRs) > 0 {
+		c.prefixes = nil
+		for _, cidr := range c.CIDRs {
+			prefix, err := parsePrefix(cidr)
+			if err != nil {
+				return fmt.Errorf("cidr %q: %w", cidr, err)
+			}
+			c.prefixes = append(c.prefixes, prefix)
+		}
+		matchers++
+	}
+	if len(c.Domains) > 0 {
+		matchers++
+	}
+	if matchers != 1 {
+		return fmt.Errorf("exactly one of regex, cidrs or domains is expected")
+	}
+	return nil
+}
+
+// parsePrefix parses the CIDR or a single address as its full length prefix.
+func parsePrefix(value string) (netip.Prefix, error) {
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Evaluate returns the action and the rule deciding it, nil rule for the default action.
+func (p *CallPolicy) Evaluate(toolName, args string) (CallAction, *CallRule) {
+	var decoded any
+	if err := json.Unmarshal([]byte(args), &decoded); err != nil {
+		decoded = nil
+	}
+
+	for idx := range p.Rules {
+		rule := &p.Rules[idx]
+		if rule.matches(toolName, args, decoded) {
+			return rule.Action, rule
+		}
+	}
+	if p.Default == "" {
+		return CallAllow, nil
+	}
+	return p.Default, nil
+}
+
+func (r *CallRule) matches(toolName, args string, decoded any) bool {
+	if len(r.Tools) > 0 {
+		matched := false
+		for _, pattern := range r.Tools {
+			if ok, _ := path.Match(pattern, toolName); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for _, condition := range r.Conditions {
+		if !condition.matches(args, decoded) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c CallCondition) matches(args string, decoded any) bool {
+	values := []string{args}
+	if c.Argument != "" {
+		values = argumentValues(decoded, strings.Split(c.Argument, "."))
+	}
+	for _, value := range values {
+		if c.matchValue(value) != c.Negate {
+			return true
+		}
+	}
+	return false
+}
+
+func (c CallCondition) matchValue(value string) bool {
+	switch {
+	case c.regex != nil:
+		return c.regex.MatchString(value)
+	case len(c.prefixes) > 0:
+		target, err := parsePrefix(strings.TrimSpace(value))
+		if err != nil {
+			// Host names are never in the CIDRs
+			return false
+		}
+		for _, prefix := range c.prefixes {
+			if prefix.Bits() <= target.Bits() && prefix.Contains(target.Addr()) {
+				return true
+			}
+		}
+		return false
+	case len(c.Domains) > 0:
+		host := strings.ToLower(strings.TrimSpace(value))
+		if u, err := url.Parse(host); err == nil && u.Host != "" {
+			host = u.Hostname()
+		}
+		host = strings.TrimSuffix(host, ".")
+		for _, domain := range c.Domains {
+			domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// argumentValues returns the string values at the path, flattening the arrays.
+func argumentValues(val any, argPath []string) []string {
+	if items, ok := val.([]any); ok {
+		values := []string{}
+		for _, item := range items {
+			values = append(values, argumentValues(item, argPath)...)
+		}
+		return values
+	}
+	if len(argPath) == 0 {
+		switch v := val.(type) {
+		case nil:
+			return nil
+		case string:
+			return []string{v}
+		default:
+			data, _ := json.Marshal(v)
+			return []string{string(data)}
+		}
+	}
+	object, ok := val.(map[string]any)
+	if !ok {
+		return nil
+	}
+	return argumentValues(object[argPath[0]], argPath[1:])
+}
+
+// ApprovalRequest is the call waiting for the approval by the rule.
+type ApprovalRequest struct {
+	Tool      string
+	Arguments string
+	Rule      string
+	Message   string
+}
+
+// Approver decides on the calls requiring an approval.
+type Approver func(ctx context.Context, request ApprovalRequest) (bool, error)
+
+// authorize evaluates the call policy, returning the audit decision and the denial error.
+func (e *ToolsExecutor) authorize(ctx context.Context, toolName, args string) (string, error) {
+	if e.CallPolicy == nil {
+		return AuditDecisionAllowed, nil
+	}
+
+	action, rule := e.CallPolicy.Evaluate(toolName, args)
+	ruleName, message := "default", ""
+	if rule != nil {
+		ruleName, message = rule.Name, rule.Message
+	}
+
+	switch action {
+	case CallDeny:
+		if e.CallPolicy.DryRun {
+			log.Warn().Str("rule", ruleName).Str("args", args).Msgf("Tool %s call would be denied (dry run)", toolName)
+			return AuditDecisionDryRunDenied, nil
+		}
+		return AuditDecisionDenied, denial(toolName, ruleName, message)
+	case CallApprove:
+		if e.CallPolicy.DryRun {
+			log.Warn().Str("rule", ruleName).Str("args", args).Msgf("Tool %s call would require an approval (dry run)", toolName)
+			return AuditDecisionDryRunApproval, nil
+		}
+		if e.Approver == nil {
+			return AuditDecisionDenied, denial(toolName, ruleName, "requires an approval, but there is no approver")
+		}
+		approved, err := e.Approver(ctx, ApprovalRequest{
+			Tool:      toolName,
+			Arguments: args,
+			Rule:      ruleName,
+			Message:   message,
+		})
+		if err != nil {
+			return AuditDecisionDenied, fmt.Errorf("%w: approval: %w", ErrCallDenied, err)
+		}
+		if !approved {
+			return AuditDecisionDenied, denial(toolName, ruleName, "not approved")
+		}
+		return AuditDecisionApproved, nil
+	}
+	return AuditDecisionAllowed, nil
+}
+
+func denial(toolName, ruleName, message string) error {
+	err := fmt.Errorf("%w: %s call matched the rule %s", ErrCallDenied, toolName, ruleName)
+	if message != "" {
+		err = fmt.Errorf("%w: %s", err, message)
+	}
+	return err
+}
@@ -0,0 +1,185 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/rs/zerolog/log"
+)
+
+// initialize runs the tool Init once before its first use, a failed Init is retried on the next use.
+func (t *ToolData) initialize(ctx context.Context) error {
+	if t.Init == nil {
+		return nil
+	}
+	t.initMu.Lock()
+	defer t.initMu.Unlock()
+
+	if t.initialized {
+		return nil
+	}
+	if err := t.Init(ctx); err != nil {
+		return fmt.Errorf("init tool %s: %w", t.Definition.Name, err)
+	}
+	t.initialized = true
+	return nil
+}
+
+// Release closes the tool resources, so the tool is initialized again on the next use.
+func (t *ToolData) Release(ctx context.Context) error {
+	t.initMu.Lock()
+	t.initialized = false
+	t.initMu.Unlock()
+
+	switch {
+	case t.Close != nil:
+		return t.Close(ctx)
+	case t.Cleanup != nil:
+		return t.Cleanup()
+	}
+	return nil
+}
+
+// forEachTool runs the function for every tool concurrently, collecting the errors by the tool name.
+// The tools not finished until the context is done get the context error.
+func (e *ToolsExecutor) forEachTool(ctx context.Context, f func(*ToolData) error) map[string]error {
+	type result struct {
+		name string
+		err  error
+	}
+	results := make(chan result, len(e.Tools))
+	pending := map[string]bool{}
+	for name, toolData := range e.Tools {
+		pending[name] = true
+		go func() {
+			results <- result{name: name, err: f(toolData)}
+		}()
+	}
+
+	errs := map[string]error{}
+	for len(pending) > 0 {
+		select {
+		case res := <-results:
+			delete(pending, res.name)
+			if res.err != nil {
+				errs[res.name] = res.err
+			}
+		case <-ctx.Done():
+			for name := range pending {
+				errs[name] = fmt.Errorf("tool %s: %w", name, ctx.Err())
+			}
+			return errs
+		}
+	}
+	return errs
+}
+
+// Init initializes every tool eagerly, returning the failures by the tool name.
+func (e *ToolsExecutor) Init(ctx context.Context) map[string]error {
+	return e.forEachTool(ctx, func(toolData *ToolData) error {
+		return toolData.initialize(ctx)
+	})
+}
+
+// CheckHealth initializes and checks every tool, returning the unhealthy ones errors by the tool name.
+func (e *ToolsExecutor) CheckHealth(ctx context.Context) map[string]error {
+	return e.forEachTool(ctx, func(toolData *ToolData) error {
+		if err := toolData.initialize(ctx); err != nil {
+			return err
+		}
+		if toolData.Health == nil {
+			return nil
+		}
+		if err := toolData.Health(ctx); err != nil {
+			return fmt.Errorf("tool %s health: %w", toolData.Definition.Name, err)
+		}
+		return nil
+	})
+}
+
+// DisableUnhealthy checks the tools health, closing and removing the unhealthy ones from the executor.
+// It modifies the tools map, so it should not be called concurrently with the tool calls.
+func (e *ToolsExecutor) DisableUnhealthy(ctx context.Context) map[string]error {
+	errs := e.CheckHealth(ctx)
+	e.disable(ctx, errs)
+	return errs
+}
+
+func (e *ToolsExecutor) disable(ctx context.Context, errs map[string]error) {
+	for name, err := range errs {
+		toolData, ok := e.Tools[name]
+		if !ok {
+			continue
+		}
+		log.Warn().Err(err).Msgf("Tool %s disabled", name)
+		delete(e.Tools, name)
+		if e.Disabled == nil {
+			e.Disabled = map[string]error{}
+		}
+		e.Disabled[name] = err
+		if err := toolData.Release(ctx); err != nil {
+			log.Warn().Err(err).Msgf("Tool %s close", name)
+		}
+	}
+}
+
+// Close closes every tool concurrently until the context is done, aggregating the errors.
+// The tools can be used again afterwards, being initialized on the next use.
+// The stored outputs are kept, so the readMore handles stay valid.
+func (e *ToolsExecutor) Close(ctx context.Context) error {
+	errs := e.forEachTool(ctx, func(toolData *ToolData) error {
+		if err := toolData.Release(ctx); err != nil {
+			return fmt.Errorf("close tool %s: %w", toolData.Definition.Name, err)
+		}
+		return nil
+	})
+	return joinToolErrors(errs)
+}
+
+// Reset resets the session state of the tools with Reset concurrently, aggregating the errors.
+func (e *ToolsExecutor) Reset(ctx context.Context) error {
+	errs := e.forEachTool(ctx, func(toolData *ToolData) error {
+		if toolData.Reset == nil {
+			return nil
+		}
+		if err := toolData.Reset(ctx); err != nil {
+			return fmt.Errorf("reset tool %s: %w", toolData.Definition.Name, err)
+		}
+		return nil
+	})
+	return joinToolErrors(errs)
+}
+
+// joinToolErrors joins the errors ordered by the tool name.
+func joinToolErrors(errs map[string]error) error {
+	names := []string{}
+	for name := range errs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	joined := []error{}
+	for _, name := range names {
+		joined = append(joined, errs[name])
+	}
+	return errors.Join(joined...)
+}
+
+// SetupOptions are the executor startup lifecycle options.
+type SetupOptions struct {
+	// EagerInit initializes the tools on the startup instead of the first call.
+	EagerInit bool
+	// HealthCheck checks the tools health on the startup.
+	HealthCheck bool
+}
+
+// Setup runs the startup lifecycle, disabling the tools failed to initialize or unhealthy with a warning.
+func (e *ToolsExecutor) Setup(ctx context.Context, opts SetupOptions) {
+	switch {
+	case opts.HealthCheck:
+		e.DisableUnhealthy(ctx)
+	case opts.EagerInit:
+		e.disable(ctx, e.Init(ctx))
+	}
+}
@@ -0,0 +1,212 @@
+package mcpClient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/Swarmind/libagent/internal/tools"
+
+	"github.com/kballard/go-shellquote"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rs/zerolog/log"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// NamespaceSeparator joins the server and the tool names into the executor tool name.
+const NamespaceSeparator = "__"
+
+// invalidNameChars are replaced in the tool names, as the ReWOO plan parser only accepts the word characters.
+var invalidNameChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// Server is an MCP server connection, launched as a stdio subprocess or reached over streamable HTTP.
+// The session is connected lazily and reconnected after Close.
+type Server struct {
+	Name string
+	// Command is the stdio server command line, URL is the streamable HTTP endpoint. One of them is set.
+	Command []string
+	URL     string
+
+	mu      sync.Mutex
+	session *mcp.ClientSession
+}
+
+// NewServer parses the server spec: the http(s) URL of a streamable HTTP server or a stdio server command line,
+// split into the words the way the shell does, e.g. with the quoted arguments.
+func NewServer(name, spec string) (*Server, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("mcp server %s: empty command or URL", name)
+	}
+	if strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://") {
+		return &Server{Name: name, URL: spec}, nil
+	}
+	command, err := shellquote.Split(spec)
+	if err != nil {
+		return nil, fmt.Errorf("mcp server %s command: %w", name, err)
+	}
+	if len(command) == 0 {
+		return nil, fmt.Errorf("mcp server %s: empty command or URL", name)
+	}
+	return &Server{Name: name, Command: command}, nil
+}
+
+func (s *Server) connect(ctx context.Context) (*mcp.ClientSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.session != nil {
+		return s.session, nil
+	}
+
+	var transport mcp.Transport
+	if s.URL != "" {
+		transport = &mcp.StreamableClientTransport{Endpoint: s.URL}
+	} else {
+		// Not bound to the context, the process lives until Close
+		transport = &mcp.CommandTransport{Command: exec.Command(s.Command[0], s.Command[1:]...)}
+	}
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "libagent", Version: "v1"}, nil)
+	session, err := client.Connect(ctx, transport, nil)
+	if err != nil {
+		return nil, fmt.Errorf("mcp server %s connect: %w", s.Name, err)
+	}
+	log.Debug().Msgf("mcp server %s connected", s.Name)
+	s.session = session
+	return session, nil
+}
+
+// Close closes the session, stopping the stdio server process.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.session == nil {
+		return nil
+	}
+	err := s.session.Close()
+	s.session = nil
+	if err != nil {
+		return fmt.Errorf("mcp server %s close: %w", s.Name, err)
+	}
+	return nil
+}
+
+// ToolName is the executor tool name of the server tool, namespaced by the server name.
+func (s *Server) ToolName(tool string) string {
+	return invalidNameChars.ReplaceAllString(s.Name+NamespaceSeparator+tool, "_")
+}
+
+// Ping checks the server responds, reconnecting if the session is closed.
+func (s *Server) Ping(ctx context.Context) error {
+	session, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	if err := session.Ping(ctx, nil); err != nil {
+		return fmt.Errorf("mcp server %s ping: %w", s.Name, err)
+	}
+	return nil
+}
+
+// Tools lists the server tools as the executor tools, closing the session on the tool cleanup.
+func (s *Server) Tools(ctx context.Context) ([]*tools.ToolData, error) {
+	session, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	toolsData := []*tools.ToolData{}
+	for tool, err := range session.Tools(ctx, nil) {
+		if err != nil {
+			return nil, fmt.Errorf("mcp server %s list tools: %w", s.Name, err)
+		}
+
+		definition := llms.FunctionDefinition{
+			Name:        s.ToolName(tool.Name),
+			Description: tool.Description,
+			Parameters:  tool.InputSchema,
+		}
+		if definition.Description == "" {
+			definition.Description = tool.Title
+		}
+
+		toolName := tool.Name
+		toolsData = append(toolsData, &tools.ToolData{
+			Definition: definition,
+			Call: func(ctx context.Context, args string) (string, error) {
+				return s.Call(ctx, toolName, args)
+			},
+			Health:  s.Ping,
+			Cleanup: s.Close,
+		})
+	}
+	return toolsData, nil
+}
+
+// Call calls the server tool with the JSON arguments, rendering the result content as text.
+func (s *Server) Call(ctx context.Context, tool, args string) (string, error) {
+	session, err := s.connect(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.TrimSpace(args) == "" {
+		args = "{}"
+	}
+	result, err := session.CallTool(ctx, &mcp.CallToolParams{
+		Name:      tool,
+		Arguments: json.RawMessage(args),
+	})
+	if err != nil {
+		return "", fmt.Errorf("mcp server %s call %s: %w", s.Name, tool, err)
+	}
+
+	content, err := resultText(result)
+	if err != nil {
+		return "", err
+	}
+	if result.IsError {
+		return "", errors.New(content)
+	}
+	return content, nil
+}
+
+func resultText(result *mcp.CallToolResult) (string, error) {
+	parts := []string{}
+	for _, content := range result.Content {
+		switch content := content.(type) {
+		case *mcp.TextContent:
+			parts = append(parts, content.Text)
+		case *mcp.EmbeddedResource:
+			if content.Resource == nil {
+				continue
+			}
+			if content.Resource.Text != "" {
+				parts = append(parts, content.Resource.Text)
+			} else {
+				parts = append(parts, fmt.Sprintf("[resource %s %s]", content.Resource.URI, content.Resource.MIMEType))
+			}
+		case *mcp.ResourceLink:
+			parts = append(parts, fmt.Sprintf("[resource link %s %s]", content.URI, content.Description))
+		case *mcp.ImageContent:
+			parts = append(parts, fmt.Sprintf("[image %s]", content.MIMEType))
+		case *mcp.AudioContent:
+			parts = append(parts, fmt.Sprintf("[audio %s]", content.MIMEType))
+		}
+	}
+	if len(parts) == 0 && result.StructuredContent != nil {
+		structured, err := json.Marshal(result.StructuredContent)
+		if err != nil {
+			return "", fmt.Errorf("marshal structured content: %w", err)
+		}
+		return string(structured), nil
+	}
+	return strings.Join(parts, "\n"), nil
+}
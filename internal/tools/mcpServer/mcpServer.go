@@ -0,0 +1,133 @@
+package mcpServer
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/Swarmind/libagent/internal/tools"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rs/zerolog/log"
+)
+
+var Implementation = &mcp.Implementation{Name: "libagent", Version: "v1"}
+
+// NewServer builds the MCP server exposing the executor tools. Tool failures are returned
+// as the error results, so the client model can see and handle them.
+func NewServer(executor *tools.ToolsExecutor, opts *mcp.ServerOptions) *mcp.Server {
+	server := mcp.NewServer(Implementation, opts)
+
+	names := []string{}
+	for name := range executor.Tools {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		definition := executor.Tools[name].Definition
+		inputSchema := definition.Parameters
+		if inputSchema == nil {
+			inputSchema = map[string]any{"type": "object"}
+		}
+
+		server.AddTool(&mcp.Tool{
+			Name:        definition.Name,
+			Description: definition.Description,
+			InputSchema: inputSchema,
+		}, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			args := "{}"
+			if len(req.Params.Arguments) > 0 {
+				args = string(req.Params.Arguments)
+			}
+
+			content, err := executor.CallTool(ctx, name, args)
+			if err != nil {
+				log.Warn().Err(err).Msgf("mcp tool %s call with args: %s", name, args)
+				return &mcp.CallToolResult{
+					Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+					IsError: true,
+				}, nil
+			}
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: content}},
+			}, nil
+		})
+	}
+	return server
+}
+
+// ServeStdio serves the executor tools over stdio until the client disconnects, then cleans up the executor.
+func ServeStdio(ctx context.Context, executor *tools.ToolsExecutor) error {
+	defer cleanup(executor)
+	return NewServer(executor, nil).Run(ctx, &mcp.StdioTransport{})
+}
+
+// DefaultSessionTimeout closes the HTTP sessions idle for longer, if the handler options do not set the timeout,
+// so the executors of the abandoned sessions are cleaned up.
+const DefaultSessionTimeout = 30 * time.Minute
+
+type sessionServerKey struct{}
+
+// sessionServer is the server and executor built for the request starting a session.
+type sessionServer struct {
+	server   *mcp.Server
+	executor *tools.ToolsExecutor
+}
+
+// NewHTTPHandler serves the tools over streamable HTTP. Every session gets its own executor,
+// so the stateful tools are not shared between the clients. The executor is cleaned up
+// on the session end, or right away if the session is not connected.
+func NewHTTPHandler(
+	ctx context.Context,
+	newExecutor func(context.Context) (*tools.ToolsExecutor, error),
+	opts *mcp.StreamableHTTPOptions,
+) http.Handler {
+	handlerOpts := mcp.StreamableHTTPOptions{}
+	if opts != nil {
+		handlerOpts = *opts
+	}
+	if handlerOpts.SessionTimeout == 0 {
+		handlerOpts.SessionTimeout = DefaultSessionTimeout
+	}
+
+	handler := mcp.NewStreamableHTTPHandler(func(req *http.Request) *mcp.Server {
+		executor, err := newExecutor(ctx)
+		if err != nil {
+			log.Error().Err(err).Msg("mcp session tools executor")
+			return nil
+		}
+
+		server := NewServer(executor, nil)
+		if built, ok := req.Context().Value(sessionServerKey{}).(*sessionServer); ok {
+			built.server, built.executor = server, executor
+		}
+		return server
+	}, &handlerOpts)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		built := &sessionServer{}
+		handler.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), sessionServerKey{}, built)))
+		if built.server == nil {
+			return
+		}
+
+		// The failed to initialize and the stateless sessions are already closed, their Wait returns right away
+		for session := range built.server.Sessions() {
+			go func() {
+				err := session.Wait()
+				log.Debug().AnErr("reason", err).Msgf("mcp session %s ended", session.ID())
+				cleanup(built.executor)
+			}()
+			return
+		}
+		cleanup(built.executor)
+	})
+}
+
+func cleanup(executor *tools.ToolsExecutor) {
+	if err := executor.Cleanup(); err != nil {
+		log.Warn().Err(err).Msg("mcp session tools executor cleanup")
+	}
+}
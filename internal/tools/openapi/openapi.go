@@ -0,0 +1,573 @@
+package openapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Swarmind/libagent/internal/tools"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tmc/langchaingo/llms"
+	"gopkg.in/yaml.v3"
+)
+
+// NamespaceSeparator joins the spec and the operation names into the executor tool name.
+const NamespaceSeparator = "__"
+
+// BodyParameter is the function parameter holding the request body.
+const BodyParameter = "body"
+
+var invalidNameChars = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// Document is the subset of the OpenAPI 3 document used to build the tools.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Servers    []Server            `json:"servers"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+
+	// source is the document file or URL, the relative server URLs are resolved against the latter.
+	source string
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+type Components struct {
+	Schemas       map[string]any         `json:"schemas"`
+	Parameters    map[string]Parameter   `json:"parameters"`
+	RequestBodies map[string]RequestBody `json:"requestBodies"`
+}
+
+type PathItem struct {
+	Parameters []Parameter `json:"parameters"`
+	Get        *Operation  `json:"get"`
+	Put        *Operation  `json:"put"`
+	Post       *Operation  `json:"post"`
+	Delete     *Operation  `json:"delete"`
+	Options    *Operation  `json:"options"`
+	Head       *Operation  `json:"head"`
+	Patch      *Operation  `json:"patch"`
+	Trace      *Operation  `json:"trace"`
+}
+
+func (p PathItem) operation(method string) *Operation {
+	return map[string]*Operation{
+		"get":     p.Get,
+		"put":     p.Put,
+		"post":    p.Post,
+		"delete":  p.Delete,
+		"options": p.Options,
+		"head":    p.Head,
+		"patch":   p.Patch,
+		"trace":   p.Trace,
+	}[method]
+}
+
+type Operation struct {
+	OperationID string       `json:"operationId"`
+	Summary     string       `json:"summary"`
+	Description string       `json:"description"`
+	Deprecated  bool         `json:"deprecated"`
+	Parameters  []Parameter  `json:"parameters"`
+	RequestBody *RequestBody `json:"requestBody"`
+}
+
+type Parameter struct {
+	Ref         string         `json:"$ref"`
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description"`
+	Required    bool           `json:"required"`
+	Schema      map[string]any `json:"schema"`
+}
+
+type RequestBody struct {
+	Ref         string               `json:"$ref"`
+	Description string               `json:"description"`
+	Required    bool                 `json:"required"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema map[string]any `json:"schema"`
+}
+
+// Options configure the tools built from the document.
+type Options struct {
+	// Name namespaces the tool names as <name>__<operationId>, it is required.
+	Name string
+	// BaseURL overrides the first document server URL.
+	BaseURL string
+	// Headers are set on every request, e.g. the Authorization one.
+	Headers map[string]string
+	// Operations is the operation IDs allowlist, all the operations are used if empty.
+	Operations []string
+	// HTTPClient is http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// LoadTimeout limits the document fetch, if the Load context has no earlier deadline.
+const LoadTimeout = 30 * time.Second
+
+var loadClient = &http.Client{Timeout: LoadTimeout}
+
+// Load reads the OpenAPI 3 document in YAML or JSON from the file or http(s) URL.
+func Load(ctx context.Context, source string) (*Document, error) {
+	var data []byte
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := loadClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("fetch openapi document: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			return nil, fmt.Errorf("fetch openapi document: %s", resp.Status)
+		}
+		if data, err = io.ReadAll(resp.Body); err != nil {
+			return nil, fmt.Errorf("read openapi document: %w", err)
+		}
+	} else {
+		var err error
+		if data, err = os.ReadFile(source); err != nil {
+			return nil, fmt.Errorf("read openapi document: %w", err)
+		}
+	}
+
+	var raw any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse openapi document: %w", err)
+	}
+	// Round trip through JSON, so the schemas hold the JSON types expected by the arguments validation
+	normalized, err := json.Marshal(normalizeYAML(raw))
+	if err != nil {
+		return nil, fmt.Errorf("normalize openapi document: %w", err)
+	}
+	doc := &Document{source: source}
+	if err := json.Unmarshal(normalized, doc); err != nil {
+		return nil, fmt.Errorf("decode openapi document: %w", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported openapi version %q, only 3.x is supported", doc.OpenAPI)
+	}
+	return doc, nil
+}
+
+// normalizeYAML converts the non-string mapping keys, e.g. the response codes, to strings.
+func normalizeYAML(val any) any {
+	switch v := val.(type) {
+	case map[string]any:
+		for key, item := range v {
+			v[key] = normalizeYAML(item)
+		}
+		return v
+	case map[any]any:
+		m := map[string]any{}
+		for key, item := range v {
+			m[fmt.Sprint(key)] = normalizeYAML(item)
+		}
+		return m
+	case []any:
+		for idx, item := range v {
+			v[idx] = normalizeYAML(item)
+		}
+		return v
+	}
+	return val
+}
+
+// Tools builds a tool per the document operation, the unsupported operations
+// and the ones with the names colliding after sanitizing are skipped with a warning.
+func (d *Document) Tools(opts Options) ([]*tools.ToolData, error) {
+	if invalidNameChars.ReplaceAllString(opts.Name, "") == "" {
+		return nil, fmt.Errorf("no tools name namespace")
+	}
+	baseURL, err := d.baseURL(opts.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	toolsData := []*tools.ToolData{}
+	found := []string{}
+	names := map[string]string{}
+	for _, path := range slices.Sorted(maps.Keys(d.Paths)) {
+		pathItem := d.Paths[path]
+		for _, method := range methods {
+			operation := pathItem.operation(method)
+			if operation == nil {
+				continue
+			}
+			operationID := operation.OperationID
+			if operationID == "" {
+				operationID = method + "_" + path
+			}
+			operationID = strings.Trim(invalidNameChars.ReplaceAllString(operationID, "_"), "_")
+			if len(opts.Operations) > 0 && !slices.Contains(opts.Operations, operationID) {
+				continue
+			}
+			found = append(found, operationID)
+			if other, ok := names[operationID]; ok {
+				log.Warn().Msgf("openapi %s: operation %s %s skipped, its name %s is taken by %s",
+					opts.Name, strings.ToUpper(method), path, operationID, other)
+				continue
+			}
+
+			// The unsupported operation, e.g. with the binary request body, does not fail the whole document
+			tool, err := d.operationTool(opts, baseURL, method, path, operationID, pathItem, operation)
+			if err != nil {
+				log.Warn().Err(err).Msgf("openapi %s: operation %s skipped", opts.Name, operationID)
+				continue
+			}
+			names[operationID] = strings.ToUpper(method) + " " + path
+			toolsData = append(toolsData, tool)
+		}
+	}
+
+	for _, operationID := range opts.Operations {
+		if !slices.Contains(found, operationID) {
+			log.Warn().Msgf("openapi %s: allowed operation %s not found", opts.Name, operationID)
+		}
+	}
+	return toolsData, nil
+}
+
+func (d *Document) baseURL(override string) (*url.URL, error) {
+	base := override
+	if base == "" && len(d.Servers) > 0 {
+		base = d.Servers[0].URL
+	}
+	if base == "" {
+		return nil, fmt.Errorf("no base URL: the document has no servers")
+	}
+	baseURL, err := url.Parse(strings.TrimSuffix(base, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("parse base URL: %w", err)
+	}
+	if !baseURL.IsAbs() {
+		sourceURL, err := url.Parse(d.source)
+		if err != nil || !sourceURL.IsAbs() {
+			return nil, fmt.Errorf("relative base URL %s of the document file", base)
+		}
+		baseURL = sourceURL.ResolveReference(baseURL)
+	}
+	return baseURL, nil
+}
+
+// operationParameter is the function parameter of the operation request part.
+type operationParameter struct {
+	// property is the function parameter name, prefixed by the location if the name is in several locations
+	property string
+	name     string
+	in       string
+}
+
+func (d *Document) operationTool(
+	opts Options, baseURL *url.URL,
+	method, path, operationID string,
+	pathItem PathItem, operation *Operation,
+) (*tools.ToolData, error) {
+	properties := map[string]any{}
+	required := []string{}
+	params := []operationParameter{}
+
+	// The operation parameters override the path item ones with the same name and location
+	declared := map[string]Parameter{}
+	for _, param := range slices.Concat(pathItem.Parameters, operation.Parameters) {
+		param, err := d.parameter(param)
+		if err != nil {
+			return nil, err
+		}
+		declared[param.In+":"+param.Name] = param
+	}
+	locations := map[string]int{}
+	for _, param := range declared {
+		locations[param.Name]++
+	}
+	for _, key := range slices.Sorted(maps.Keys(declared)) {
+		param := declared[key]
+		property := param.Name
+		if locations[param.Name] > 1 {
+			property = param.In + "_" + param.Name
+		}
+		if _, ok := properties[property]; ok {
+			return nil, fmt.Errorf("parameter %s in %s collides with another parameter", param.Name, param.In)
+		}
+
+		schema := map[string]any{"type": "string"}
+		if param.Schema != nil {
+			schema, _ = d.resolveSchema(param.Schema).(map[string]any)
+		}
+		if param.Description != "" {
+			schema["description"] = param.Description
+		}
+		properties[property] = schema
+		if param.Required || param.In == "path" {
+			required = append(required, property)
+		}
+		params = append(params, operationParameter{property: property, name: param.Name, in: param.In})
+	}
+
+	bodyName, bodyType := "", ""
+	if operation.RequestBody != nil {
+		body, err := d.requestBody(*operation.RequestBody)
+		if err != nil {
+			return nil, err
+		}
+		var mediaType MediaType
+		for _, contentType := range []string{"application/json", "text/plain"} {
+			if media, ok := body.Content[contentType]; ok {
+				bodyType, mediaType = contentType, media
+				break
+			}
+		}
+		if bodyType == "" {
+			return nil, fmt.Errorf("unsupported request body content types %v", slices.Sorted(maps.Keys(body.Content)))
+		}
+
+		bodyName = BodyParameter
+		if _, ok := properties[bodyName]; ok {
+			bodyName = "requestBody"
+		}
+		schema := map[string]any{"type": "string"}
+		if mediaType.Schema != nil && bodyType == "application/json" {
+			schema, _ = d.resolveSchema(mediaType.Schema).(map[string]any)
+		}
+		if body.Description != "" {
+			schema["description"] = body.Description
+		}
+		properties[bodyName] = schema
+		if body.Required {
+			required = append(required, bodyName)
+		}
+	}
+
+	description := strings.TrimSpace(operation.Summary + "\n" + operation.Description)
+	if description == "" {
+		description = strings.ToUpper(method) + " " + path
+	}
+	if operation.Deprecated {
+		description = "Deprecated. " + description
+	}
+
+	name := invalidNameChars.ReplaceAllString(opts.Name, "_") + NamespaceSeparator + operationID
+
+	client := opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	request := operationRequest{
+		client:   client,
+		method:   strings.ToUpper(method),
+		baseURL:  baseURL,
+		path:     path,
+		params:   params,
+		bodyName: bodyName,
+		bodyType: bodyType,
+		headers:  opts.Headers,
+	}
+
+	return &tools.ToolData{
+		Definition: llms.FunctionDefinition{
+			Name:        name,
+			Description: description,
+			Parameters: map[string]any{
+				"type":       "object",
+				"properties": properties,
+				"required":   required,
+			},
+		},
+		Call: request.call,
+	}, nil
+}
+
+func (d *Document) parameter(param Parameter) (Parameter, error) {
+	if param.Ref == "" {
+		return param, nil
+	}
+	name, ok := strings.CutPrefix(param.Ref, "#/components/parameters/")
+	if !ok {
+		return param, fmt.Errorf("unsupported parameter reference %s", param.Ref)
+	}
+	resolved, ok := d.Components.Parameters[name]
+	if !ok {
+		return param, fmt.Errorf("unknown parameter reference %s", param.Ref)
+	}
+	return resolved, nil
+}
+
+func (d *Document) requestBody(body RequestBody) (RequestBody, error) {
+	if body.Ref == "" {
+		return body, nil
+	}
+	name, ok := strings.CutPrefix(body.Ref, "#/components/requestBodies/")
+	if !ok {
+		return body, fmt.Errorf("unsupported request body reference %s", body.Ref)
+	}
+	resolved, ok := d.Components.RequestBodies[name]
+	if !ok {
+		return body, fmt.Errorf("unknown request body reference %s", body.Ref)
+	}
+	return resolved, nil
+}
+
+// resolveSchema returns the schema copy with the component schema references inlined.
+// The recursive references are left as plain objects.
+func (d *Document) resolveSchema(schema any, refs ...string) any {
+	switch s := schema.(type) {
+	case map[string]any:
+		if ref, ok := s["$ref"].(string); ok {
+			name, _ := strings.CutPrefix(ref, "#/components/schemas/")
+			resolved, ok := d.Components.Schemas[name]
+			if !ok || slices.Contains(refs, ref) {
+				return map[string]any{"type": "object"}
+			}
+			return d.resolveSchema(resolved, append(slices.Clone(refs), ref)...)
+		}
+		resolved := map[string]any{}
+		for key, val := range s {
+			resolved[key] = d.resolveSchema(val, refs...)
+		}
+		return resolved
+	case []any:
+		resolved := []any{}
+		for _, val := range s {
+			resolved = append(resolved, d.resolveSchema(val, refs...))
+		}
+		return resolved
+	}
+	return schema
+}
+
+type operationRequest struct {
+	client   *http.Client
+	method   string
+	baseURL  *url.URL
+	path     string
+	params   []operationParameter
+	bodyName string
+	bodyType string
+	headers  map[string]string
+}
+
+func (o operationRequest) call(ctx context.Context, args string) (string, error) {
+	values := map[string]any{}
+	if strings.TrimSpace(args) != "" {
+		decoder := json.NewDecoder(strings.NewReader(args))
+		decoder.UseNumber()
+		if err := decoder.Decode(&values); err != nil {
+			return "", fmt.Errorf("decode arguments: %w", err)
+		}
+	}
+
+	// The raw path keeps the escaped parameters, e.g. the slashes in the values
+	path, rawPath := o.path, o.path
+	query := url.Values{}
+	headers := http.Header{}
+	cookies := []*http.Cookie{}
+	for _, param := range o.params {
+		val, ok := values[param.property]
+		if !ok || val == nil {
+			continue
+		}
+		switch param.in {
+		case "path":
+			path = strings.ReplaceAll(path, "{"+param.name+"}", formatValue(val))
+			rawPath = strings.ReplaceAll(rawPath, "{"+param.name+"}", url.PathEscape(formatValue(val)))
+		case "query":
+			if items, ok := val.([]any); ok {
+				for _, item := range items {
+					query.Add(param.name, formatValue(item))
+				}
+			} else {
+				query.Set(param.name, formatValue(val))
+			}
+		case "header":
+			headers.Set(param.name, formatValue(val))
+		case "cookie":
+			cookies = append(cookies, &http.Cookie{Name: param.name, Value: formatValue(val)})
+		}
+	}
+
+	requestURL := *o.baseURL
+	requestURL.Path = strings.TrimSuffix(requestURL.Path, "/") + path
+	requestURL.RawPath = strings.TrimSuffix(o.baseURL.EscapedPath(), "/") + rawPath
+	requestURL.RawQuery = query.Encode()
+
+	var body io.Reader
+	if val, ok := values[o.bodyName]; ok && o.bodyName != "" {
+		if o.bodyType == "application/json" {
+			data, err := json.Marshal(val)
+			if err != nil {
+				return "", fmt.Errorf("encode request body: %w", err)
+			}
+			body = bytes.NewReader(data)
+		} else {
+			body = strings.NewReader(formatValue(val))
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, o.method, requestURL.String(), body)
+	if err != nil {
+		return "", err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", o.bodyType)
+	}
+	for key, val := range o.headers {
+		req.Header.Set(key, val)
+	}
+	for key := range headers {
+		req.Header.Set(key, headers.Get(key))
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("%s %s: %s: %s", o.method, path, resp.Status, strings.TrimSpace(string(data)))
+	}
+	return string(data), nil
+}
+
+func formatValue(val any) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return fmt.Sprint(v)
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		return fmt.Sprint(val)
+	}
+	return string(data)
+}
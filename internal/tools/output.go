@@ -0,0 +1,115 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ReadMoreToolName = "readMore"
+	// MaxStoredOutputs is the number of the truncated outputs kept for readMore, the oldest ones are evicted.
+	MaxStoredOutputs = 64
+)
+
+type ReadMoreArgs struct {
+	Handle string `json:"handle" description:"The output handle from the truncation marker" required:"true" minLength:"1"`
+	Offset int    `json:"offset" description:"The byte offset to continue reading from" required:"true" minimum:"0"`
+}
+
+type storedOutput struct {
+	content string
+	limit   int
+}
+
+type outputStore struct {
+	mu      sync.Mutex
+	outputs map[string]storedOutput
+	order   []string
+}
+
+func (s *outputStore) put(content string, limit int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.outputs == nil {
+		s.outputs = map[string]storedOutput{}
+	}
+	handle := uuid.New().String()[:8]
+	s.outputs[handle] = storedOutput{content: content, limit: limit}
+	s.order = append(s.order, handle)
+	for len(s.order) > MaxStoredOutputs {
+		delete(s.outputs, s.order[0])
+		s.order = s.order[1:]
+	}
+	return handle
+}
+
+func (s *outputStore) get(handle string) (storedOutput, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	output, ok := s.outputs[handle]
+	return output, ok
+}
+
+func (e *ToolsExecutor) outputLimit(toolName string) int {
+	if toolName == ReadMoreToolName {
+		return 0
+	}
+	if limit, ok := e.OutputLimits[toolName]; ok {
+		return limit
+	}
+	return e.DefaultOutputLimit
+}
+
+// limitOutput truncates the output over the tool limit, storing the full output for readMore.
+func (e *ToolsExecutor) limitOutput(toolName, content string) string {
+	limit := e.outputLimit(toolName)
+	if limit <= 0 || len(content) <= limit {
+		return content
+	}
+
+	handle := e.outputs.put(content, limit)
+	return outputPage(handle, content, 0, limit)
+}
+
+func outputPage(handle, content string, offset, limit int) string {
+	end := runeBoundary(content, min(offset+limit, len(content)))
+	page := content[offset:end]
+	if end >= len(content) {
+		return page
+	}
+	return fmt.Sprintf(
+		"%s\n...[output truncated: shown bytes %d-%d of %d, call %s with "+
+			`{"handle": "%s", "offset": %d} to read more]`,
+		page, offset, end, len(content), ReadMoreToolName, handle, end,
+	)
+}
+
+// runeBoundary moves the byte offset back to the nearest rune start.
+func runeBoundary(content string, offset int) int {
+	for offset > 0 && offset < len(content) && !utf8.RuneStart(content[offset]) {
+		offset--
+	}
+	return offset
+}
+
+// ReadMoreTool returns the tool paging through the outputs truncated by the executor.
+func (e *ToolsExecutor) ReadMoreTool() *ToolData {
+	return NewTool(ReadMoreToolName,
+		`Reads the continuation of a truncated tool output by the handle and offset from the truncation marker.`,
+		func(ctx context.Context, args ReadMoreArgs) (string, error) {
+			output, ok := e.outputs.get(args.Handle)
+			if !ok {
+				return "", fmt.Errorf("unknown or expired output handle %q", args.Handle)
+			}
+			if args.Offset >= len(output.content) {
+				return "", fmt.Errorf("offset %d is past the output end %d", args.Offset, len(output.content))
+			}
+			return outputPage(args.Handle, output.content, runeBoundary(output.content, args.Offset), output.limit), nil
+		},
+	)
+}
@@ -0,0 +1,453 @@
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Swarmind/libagent/internal/tools"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Plugin modes. An exec plugin is run as `<plugin> call <tool>` per call, with the arguments JSON on stdin
+// and the result on stdout. An rpc plugin is run once as `<plugin> serve`, reading the JSON-RPC 2.0
+// requests {"jsonrpc": "2.0", "id": 1, "method": "call", "params": {"name": "<tool>", "arguments": {...}}}
+// and writing the responses {"jsonrpc": "2.0", "id": 1, "result": "..."} a line each.
+const (
+	ModeExec = "exec"
+	ModeRPC  = "rpc"
+)
+
+const (
+	DefaultTimeout = 30 * time.Second
+	// describeTimeout bounds the `<plugin> describe` run.
+	describeTimeout = 10 * time.Second
+	// stderrLimit is the captured stderr tail size, which is logged and added to the errors.
+	stderrLimit = 4096
+	// rpcStopTimeout is waited for the rpc plugin to exit on the stdin close, before it is killed.
+	rpcStopTimeout = 2 * time.Second
+)
+
+// NamespaceSeparator joins the plugin and the tool names into the executor tool name.
+const NamespaceSeparator = "__"
+
+var (
+	validName        = regexp.MustCompile(`^\w+$`)
+	invalidNameChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+)
+
+// Description is the `<plugin> describe` output. A single tool plugin can describe its tool
+// at the top level instead of the tools list.
+type Description struct {
+	// Mode is exec if empty.
+	Mode  string            `json:"mode"`
+	Tools []ToolDescription `json:"tools"`
+	ToolDescription
+}
+
+type ToolDescription struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Parameters  any       `json:"parameters"`
+	Examples    []Example `json:"examples"`
+}
+
+type Example struct {
+	Arguments json.RawMessage `json:"arguments"`
+	Comment   string          `json:"comment"`
+}
+
+type Options struct {
+	// Timeout of a call, DefaultTimeout if zero.
+	Timeout time.Duration
+}
+
+// Plugin is an executable providing the tools.
+type Plugin struct {
+	Name        string
+	Path        string
+	Description Description
+	Timeout     time.Duration
+
+	mu  sync.Mutex
+	rpc *rpcProcess
+}
+
+// Discover loads the executable files of the directory as plugins, the failing ones
+// and the ones named the same as the previous plugin, e.g. tool.sh and tool.py, are logged and skipped.
+func Discover(ctx context.Context, dir string, opts Options) ([]*Plugin, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("plugins dir: %w", err)
+	}
+
+	plugins := []*Plugin{}
+	paths := map[string]string{}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		// Stat follows the symlinks
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0o111 == 0 {
+			continue
+		}
+
+		plugin, err := Load(ctx, path, opts)
+		if err != nil {
+			log.Warn().Err(err).Msgf("plugin %s skipped", path)
+			continue
+		}
+		if other, ok := paths[plugin.ToolName("")]; ok {
+			log.Warn().Msgf("plugin %s skipped: its name is taken by %s", path, other)
+			continue
+		}
+		paths[plugin.ToolName("")] = path
+		plugins = append(plugins, plugin)
+	}
+	return plugins, nil
+}
+
+// Load runs the plugin describe command.
+func Load(ctx context.Context, path string, opts Options) (*Plugin, error) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	plugin := &Plugin{
+		Name:    name,
+		Path:    path,
+		Timeout: opts.Timeout,
+	}
+	if plugin.Timeout <= 0 {
+		plugin.Timeout = DefaultTimeout
+	}
+
+	describeCtx, cancel := context.WithTimeout(ctx, describeTimeout)
+	defer cancel()
+	output, err := plugin.run(describeCtx, "", "describe")
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(output), &plugin.Description); err != nil {
+		return nil, fmt.Errorf("plugin %s describe output: %w", name, err)
+	}
+
+	description := &plugin.Description
+	if description.Name != "" {
+		description.Tools = append(description.Tools, description.ToolDescription)
+	}
+	if len(description.Tools) == 0 {
+		return nil, fmt.Errorf("plugin %s describes no tools", name)
+	}
+	switch description.Mode {
+	case "":
+		description.Mode = ModeExec
+	case ModeExec, ModeRPC:
+	default:
+		return nil, fmt.Errorf("plugin %s unknown mode %q, expected exec or rpc", name, description.Mode)
+	}
+	for _, tool := range description.Tools {
+		if !validName.MatchString(tool.Name) {
+			return nil, fmt.Errorf("plugin %s tool name %q is not a word", name, tool.Name)
+		}
+	}
+	return plugin, nil
+}
+
+// ToolName is the executor tool name of the plugin tool, namespaced by the plugin name.
+func (p *Plugin) ToolName(tool string) string {
+	return invalidNameChars.ReplaceAllString(p.Name, "_") + NamespaceSeparator + tool
+}
+
+// Tools returns the plugin tools named by ToolName,
+// the rpc plugin process is started on the first call and stopped on the cleanup.
+func (p *Plugin) Tools() []*tools.ToolData {
+	toolsData := []*tools.ToolData{}
+	for _, tool := range p.Description.Tools {
+		toolName := tool.Name
+		toolData := &tools.ToolData{
+			Definition: llms.FunctionDefinition{
+				Name:        p.ToolName(tool.Name),
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+			Call: func(ctx context.Context, args string) (string, error) {
+				return p.Call(ctx, toolName, args)
+			},
+		}
+		for _, example := range tool.Examples {
+			toolData.Examples = append(toolData.Examples, tools.ToolExample{
+				Arguments: string(example.Arguments),
+				Comment:   example.Comment,
+			})
+		}
+		if p.Description.Mode == ModeRPC {
+			toolData.Cleanup = p.Close
+		}
+		toolsData = append(toolsData, toolData)
+	}
+	return toolsData
+}
+
+// Call calls the plugin tool with the JSON arguments, bounded by the plugin timeout.
+func (p *Plugin) Call(ctx context.Context, tool, args string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	if p.Description.Mode == ModeRPC {
+		return p.callRPC(ctx, tool, args)
+	}
+	return p.run(ctx, args, "call", tool)
+}
+
+// run runs the plugin command with the stdin, returning its stdout.
+func (p *Plugin) run(ctx context.Context, stdin string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, p.Path, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	stdout := &bytes.Buffer{}
+	stderr := &tailBuffer{limit: stderrLimit}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	// The plugin children holding the pipes do not block the return after the kill
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	if stderrText := stderr.String(); stderrText != "" {
+		log.Debug().Str("stderr", stderrText).Msgf("plugin %s %s", p.Name, args[0])
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("%w: %w", ctx.Err(), err)
+		}
+		return "", p.error(args[0], err, stderr.String())
+	}
+	return stdout.String(), nil
+}
+
+func (p *Plugin) error(action string, err error, stderr string) error {
+	if stderr = strings.TrimSpace(stderr); stderr != "" {
+		return fmt.Errorf("plugin %s %s: %w\nstderr: %s", p.Name, action, err, stderr)
+	}
+	return fmt.Errorf("plugin %s %s: %w", p.Name, action, err)
+}
+
+// Close stops the rpc plugin process, it is started again on the next call.
+func (p *Plugin) Close() error {
+	p.mu.Lock()
+	rpc := p.rpc
+	p.rpc = nil
+	p.mu.Unlock()
+
+	if rpc == nil {
+		return nil
+	}
+	return rpc.stop()
+}
+
+type rpcRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      int64         `json:"id"`
+	Method  string        `json:"method"`
+	Params  rpcCallParams `json:"params"`
+}
+
+type rpcCallParams struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type rpcResponse struct {
+	ID     int64           `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcProcess struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr *tailBuffer
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan rpcResponse
+
+	done    chan struct{}
+	exitErr error
+}
+
+func (p *Plugin) process() (*rpcProcess, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.rpc != nil {
+		select {
+		case <-p.rpc.done:
+			log.Warn().Err(p.rpc.exitErr).Str("stderr", p.rpc.stderr.String()).Msgf("plugin %s exited, restarting", p.Name)
+		default:
+			return p.rpc, nil
+		}
+	}
+
+	// Not bound to the call context, the process serves the calls until Close
+	cmd := exec.Command(p.Path, "serve")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	rpc := &rpcProcess{
+		cmd:     cmd,
+		stdin:   stdin,
+		stderr:  &tailBuffer{limit: stderrLimit},
+		pending: map[int64]chan rpcResponse{},
+		done:    make(chan struct{}),
+	}
+	cmd.Stderr = rpc.stderr
+	if err := cmd.Start(); err != nil {
+		return nil, p.error("serve", err, "")
+	}
+	go rpc.read(p.Name, stdout)
+
+	p.rpc = rpc
+	return rpc, nil
+}
+
+// read dispatches the responses until the process stdout is closed.
+func (r *rpcProcess) read(name string, stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		response := rpcResponse{}
+		if err := json.Unmarshal(scanner.Bytes(), &response); err != nil {
+			log.Warn().Err(err).Str("line", scanner.Text()).Msgf("plugin %s invalid response", name)
+			continue
+		}
+		r.mu.Lock()
+		ch, ok := r.pending[response.ID]
+		delete(r.pending, response.ID)
+		r.mu.Unlock()
+		if ok {
+			ch <- response
+		}
+	}
+
+	r.exitErr = r.cmd.Wait()
+	if r.exitErr == nil {
+		r.exitErr = errors.New("plugin process exited")
+	}
+	close(r.done)
+}
+
+func (p *Plugin) callRPC(ctx context.Context, tool, args string) (string, error) {
+	rpc, err := p.process()
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(args) == "" {
+		args = "{}"
+	}
+
+	rpc.mu.Lock()
+	rpc.nextID++
+	id := rpc.nextID
+	ch := make(chan rpcResponse, 1)
+	rpc.pending[id] = ch
+	rpc.mu.Unlock()
+	defer func() {
+		rpc.mu.Lock()
+		delete(rpc.pending, id)
+		rpc.mu.Unlock()
+	}()
+
+	request, err := json.Marshal(rpcRequest{
+		JSONRPC: "2.0",
+		ID:      id,
+		Method:  "call",
+		Params:  rpcCallParams{Name: tool, Arguments: json.RawMessage(args)},
+	})
+	if err != nil {
+		return "", err
+	}
+	rpc.writeMu.Lock()
+	_, err = rpc.stdin.Write(append(request, '\n'))
+	rpc.writeMu.Unlock()
+	if err != nil {
+		return "", p.error("call", err, rpc.stderr.String())
+	}
+
+	select {
+	case response := <-ch:
+		if response.Error != nil {
+			return "", fmt.Errorf("plugin %s call %s: %s (code %d)", p.Name, tool, response.Error.Message, response.Error.Code)
+		}
+		var text string
+		if err := json.Unmarshal(response.Result, &text); err == nil {
+			return text, nil
+		}
+		return string(response.Result), nil
+	case <-rpc.done:
+		return "", p.error("call", rpc.exitErr, rpc.stderr.String())
+	case <-ctx.Done():
+		return "", p.error("call", ctx.Err(), rpc.stderr.String())
+	}
+}
+
+// stop closes the process stdin, killing it if it does not exit in time.
+func (r *rpcProcess) stop() error {
+	r.stdin.Close()
+	select {
+	case <-r.done:
+		return nil
+	case <-time.After(rpcStopTimeout):
+	}
+	if err := r.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	<-r.done
+	return nil
+}
+
+// tailBuffer keeps the last limit bytes written.
+type tailBuffer struct {
+	limit int
+
+	mu   sync.Mutex
+	data []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.data = append(b.data, p...)
+	if len(b.data) > b.limit {
+		b.data = b.data[len(b.data)-b.limit:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.data)
+}
@@ -0,0 +1,182 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var ErrToolUnavailable = errors.New("tool is temporarily unavailable")
+
+const (
+	DefaultRetryBackoff    = time.Second
+	DefaultMaxRetryBackoff = 30 * time.Second
+	DefaultBreakerCooldown = time.Minute
+)
+
+// ExecutionPolicy defines how the tool calls are executed by the ToolsExecutor.
+type ExecutionPolicy struct {
+	// Timeout of a single call attempt, enforced through the call context. Zero means no timeout.
+	Timeout time.Duration
+
+	// Idempotent tools are retried MaxRetries times on failure,
+	// waiting Backoff (DefaultRetryBackoff if zero) doubled after every attempt up to MaxBackoff.
+	Idempotent bool
+	MaxRetries int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// BreakerThreshold consecutive failed calls disable the tool for BreakerCooldown
+	// (DefaultBreakerCooldown if zero). Zero threshold disables the circuit breaker.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// CacheTTL of the successful call results, used if the executor has the Cache. Zero disables the caching.
+	CacheTTL time.Duration
+}
+
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// allow returns an error if the breaker is open. After the cooldown a single probe call is let through.
+func (b *circuitBreaker) allow(tool string, policy ExecutionPolicy) error {
+	if policy.BreakerThreshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < policy.BreakerThreshold {
+		return nil
+	}
+	if now := time.Now(); now.Before(b.openUntil) || b.probing {
+		return fmt.Errorf("%w: %s failed %d times in a row, retry in %s or use another tool",
+			ErrToolUnavailable, tool, b.failures, max(time.Until(b.openUntil), 0).Round(time.Second),
+		)
+	}
+	b.probing = true
+	return nil
+}
+
+// abort releases the probe of the call which did not finish, e.g. on the parent context cancellation.
+func (b *circuitBreaker) abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *circuitBreaker) record(policy ExecutionPolicy, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if err == nil {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if policy.BreakerThreshold > 0 && b.failures >= policy.BreakerThreshold {
+		cooldown := policy.BreakerCooldown
+		if cooldown <= 0 {
+			cooldown = DefaultBreakerCooldown
+		}
+		b.openUntil = time.Now().Add(cooldown)
+	}
+}
+
+func (e *ToolsExecutor) policy(toolName string) ExecutionPolicy {
+	if policy, ok := e.Policies[toolName]; ok {
+		return policy
+	}
+	return e.DefaultPolicy
+}
+
+func (e *ToolsExecutor) breaker(toolName string) *circuitBreaker {
+	e.breakersMu.Lock()
+	defer e.breakersMu.Unlock()
+
+	if e.breakers == nil {
+		e.breakers = map[string]*circuitBreaker{}
+	}
+	b, ok := e.breakers[toolName]
+	if !ok {
+		b = &circuitBreaker{}
+		e.breakers[toolName] = b
+	}
+	return b
+}
+
+// callWithPolicy calls the tool applying its execution policy.
+// Validation errors and the parent context cancellation are neither retried nor counted by the breaker.
+func (e *ToolsExecutor) callWithPolicy(ctx context.Context, toolData *ToolData, args string) (string, error) {
+	name := toolData.Definition.Name
+	policy := e.policy(name)
+	breaker := e.breaker(name)
+	if err := breaker.allow(name, policy); err != nil {
+		return "", err
+	}
+
+	attempts := 1
+	if policy.Idempotent {
+		attempts += max(policy.MaxRetries, 0)
+	}
+	backoff := policy.Backoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	maxBackoff := policy.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxRetryBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		content, err := callWithTimeout(ctx, toolData, args, policy.Timeout)
+		if ctx.Err() != nil {
+			breaker.abort()
+			return content, err
+		}
+		if err == nil {
+			breaker.record(policy, nil)
+			return content, nil
+		}
+		if attempt >= attempts {
+			breaker.record(policy, err)
+			return "", err
+		}
+
+		log.Warn().
+			Err(err).
+			Int("attempt", attempt).
+			Dur("backoff", backoff).
+			Msgf("Tool %s call retry", name)
+		select {
+		case <-ctx.Done():
+			breaker.abort()
+			return "", ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func callWithTimeout(ctx context.Context, toolData *ToolData, args string, timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		return toolData.Call(ctx, args)
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	content, err := toolData.Call(callCtx, args)
+	if err != nil && ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("tool %s timed out after %s: %w", toolData.Definition.Name, timeout, err)
+	}
+	return content, err
+}
@@ -0,0 +1,366 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// PromptDescMode selects how ToolsPromptDesc renders the tool parameters.
+type PromptDescMode int
+
+const (
+	// PromptDescCompact renders the parameters as a single line signature, e.g. {query: string, limit?: integer = 5}.
+	PromptDescCompact PromptDescMode = iota
+	// PromptDescVerbose renders a parameter per line with its description and constraints.
+	PromptDescVerbose
+)
+
+// ToolExample is an example call of the tool shown in the tools prompt.
+type ToolExample struct {
+	// Arguments JSON of the call.
+	Arguments string
+	// Comment explains the call, optional.
+	Comment string
+}
+
+// ToolsPromptDesc renders the tools list for the prompt, skipping the excluded tools.
+// The parameters are rendered in the executor PromptDescMode, with the tools examples.
+func (e *ToolsExecutor) ToolsPromptDesc(exclude ...string) string {
+	tools := []*ToolData{{Definition: LLMDefinition}}
+	for _, toolData := range e.Tools {
+		if slices.Contains(exclude, toolData.Definition.Name) {
+			continue
+		}
+		tools = append(tools, toolData)
+	}
+	slices.SortFunc(tools, func(a, b *ToolData) int {
+		return strings.Compare(a.Definition.Name, b.Definition.Name)
+	})
+
+	desc := ""
+	for idx, toolData := range tools {
+		desc += toolPromptDesc(idx, toolData.Definition, toolData.Examples, e.PromptDescMode)
+	}
+	return desc
+}
+
+func toolPromptDesc(idx int, def llms.FunctionDefinition, examples []ToolExample, mode PromptDescMode) string {
+	schema := schemaMap(def.Parameters)
+	if mode != PromptDescVerbose {
+		input := "string"
+		if schema != nil {
+			input = SchemaPromptDesc(schema)
+		}
+		desc := fmt.Sprintf("(%d) %s[%s]: %s\n", idx, def.Name, input, def.Description)
+		if len(examples) > 0 {
+			desc += fmt.Sprintf("\tExample: %s\n", exampleCall(def.Name, examples[0]))
+		}
+		return desc
+	}
+
+	desc := fmt.Sprintf("(%d) %s: %s\n", idx, def.Name, def.Description)
+	if schema == nil {
+		desc += "\tInput: string\n"
+	} else {
+		r := schemaRenderer{root: schema}
+		desc += "\tInput: JSON " + r.typeName(schema, nil) + "\n"
+		for _, line := range r.propertyLines(schema, 2, nil) {
+			desc += line + "\n"
+		}
+	}
+	if len(examples) > 0 {
+		desc += "\tExamples:\n"
+		for _, example := range examples {
+			desc += "\t\t" + exampleCall(def.Name, example) + "\n"
+		}
+	}
+	return desc
+}
+
+func exampleCall(name string, example ToolExample) string {
+	call := fmt.Sprintf("%s[%s]", name, example.Arguments)
+	if example.Comment != "" {
+		call += " - " + example.Comment
+	}
+	return call
+}
+
+// SchemaPromptDesc renders the JSON schema as a compact signature, the optional properties are marked with "?",
+// the enums as the values union and the defaults follow "=".
+func SchemaPromptDesc(schema any) string {
+	root := schemaMap(schema)
+	if root == nil {
+		return "any"
+	}
+	r := schemaRenderer{root: root}
+	return r.compact(root, nil)
+}
+
+// schemaRenderer renders the schemas resolving the local $ref ones against the root schema.
+type schemaRenderer struct {
+	root map[string]any
+}
+
+// resolve returns the referenced schema, its name and whether the reference makes a cycle.
+func (r schemaRenderer) resolve(schema map[string]any, refs []string) (map[string]any, string, bool) {
+	ref, ok := schema["$ref"].(string)
+	if !ok {
+		return schema, "", false
+	}
+	name := ref[strings.LastIndex(ref, "/")+1:]
+	if slices.Contains(refs, ref) || !strings.HasPrefix(ref, "#") {
+		return nil, name, true
+	}
+	var target any = r.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#"), "/") {
+		if part == "" {
+			continue
+		}
+		part = strings.NewReplacer("~1", "/", "~0", "~").Replace(part)
+		object, ok := target.(map[string]any)
+		if !ok {
+			return nil, name, true
+		}
+		target = object[part]
+	}
+	resolved := schemaMap(target)
+	if resolved == nil {
+		return nil, name, true
+	}
+	return resolved, name, false
+}
+
+func (r schemaRenderer) compact(schema map[string]any, refs []string) string {
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, name, cyclic := r.resolve(schema, refs)
+		if cyclic {
+			return name
+		}
+		return r.compact(resolved, append(slices.Clone(refs), ref))
+	}
+
+	if values := anySlice(schema["enum"]); len(values) > 0 {
+		return jsonValues(values, "|")
+	}
+	if value, ok := schema["const"]; ok {
+		return jsonValues([]any{value}, "")
+	}
+	for _, key := range []string{"anyOf", "oneOf"} {
+		if variants := anySlice(schema[key]); len(variants) > 0 {
+			rendered := []string{}
+			for _, variant := range variants {
+				rendered = append(rendered, r.compact(schemaMap(variant), refs))
+			}
+			return strings.Join(rendered, "|")
+		}
+	}
+
+	types := schemaTypes(schema)
+	rendered := []string{}
+	for _, typ := range types {
+		switch typ {
+		case "object":
+			rendered = append(rendered, r.compactObject(schema, refs))
+		case "array":
+			item := "any"
+			if items := schemaMap(schema["items"]); items != nil {
+				item = r.compact(items, refs)
+			}
+			if strings.Contains(item, "|") {
+				item = "(" + item + ")"
+			}
+			rendered = append(rendered, item+"[]")
+		default:
+			rendered = append(rendered, typ)
+		}
+	}
+	if len(rendered) == 0 {
+		if schema["properties"] != nil {
+			return r.compactObject(schema, refs)
+		}
+		return "any"
+	}
+	return strings.Join(rendered, "|")
+}
+
+func (r schemaRenderer) compactObject(schema map[string]any, refs []string) string {
+	properties, _ := schema["properties"].(map[string]any)
+	if len(properties) == 0 {
+		if additional := schemaMap(schema["additionalProperties"]); additional != nil {
+			return "{[key: string]: " + r.compact(additional, refs) + "}"
+		}
+		return "object"
+	}
+
+	required := requiredProperties(schema)
+	fields := []string{}
+	for _, name := range propertyOrder(properties, required) {
+		property := schemaMap(properties[name])
+		field := name
+		if !slices.Contains(required, name) {
+			field += "?"
+		}
+		field += ": " + r.compact(property, refs)
+		if value, ok := property["default"]; ok {
+			field += " = " + jsonValues([]any{value}, "")
+		}
+		fields = append(fields, field)
+	}
+	return "{" + strings.Join(fields, ", ") + "}"
+}
+
+// typeName is the short type of the verbose property line, e.g. "array of object".
+func (r schemaRenderer) typeName(schema map[string]any, refs []string) string {
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, name, cyclic := r.resolve(schema, refs)
+		if cyclic {
+			return name
+		}
+		return r.typeName(resolved, append(slices.Clone(refs), ref))
+	}
+
+	names := []string{}
+	for _, key := range []string{"anyOf", "oneOf"} {
+		for _, variant := range anySlice(schema[key]) {
+			names = append(names, r.typeName(schemaMap(variant), refs))
+		}
+	}
+	if len(names) > 0 {
+		return strings.Join(names, " or ")
+	}
+
+	types := schemaTypes(schema)
+	if len(types) == 0 {
+		switch {
+		case schema["properties"] != nil:
+			types = []string{"object"}
+		case schema["enum"] != nil || schema["const"] != nil:
+			return r.compact(schema, refs)
+		default:
+			return "any"
+		}
+	}
+	for _, typ := range types {
+		switch typ {
+		case "array":
+			item := "any"
+			if items := schemaMap(schema["items"]); items != nil {
+				item = r.typeName(items, refs)
+			}
+			typ = "array of " + item
+		case "object":
+			additional := schemaMap(schema["additionalProperties"])
+			if additional != nil && schema["properties"] == nil {
+				typ = "map of " + r.typeName(additional, refs)
+			}
+		}
+		names = append(names, typ)
+	}
+	return strings.Join(names, " or ")
+}
+
+// propertyLines renders the object properties a line per property, nesting the object and array of objects ones.
+func (r schemaRenderer) propertyLines(schema map[string]any, depth int, refs []string) []string {
+	resolved, _, cyclic := r.resolve(schema, refs)
+	if cyclic {
+		return nil
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		refs = append(slices.Clone(refs), ref)
+	}
+	schema = resolved
+	if items := schemaMap(schema["items"]); items != nil && slices.Contains(schemaTypes(schema), "array") {
+		return r.propertyLines(items, depth, refs)
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	required := requiredProperties(schema)
+	indent := strings.Repeat("\t", depth)
+	lines := []string{}
+	for _, name := range propertyOrder(properties, required) {
+		property := schemaMap(properties[name])
+		if property == nil {
+			property = map[string]any{}
+		}
+
+		attrs := []string{r.typeName(property, refs)}
+		if slices.Contains(required, name) {
+			attrs = append(attrs, "required")
+		} else {
+			attrs = append(attrs, "optional")
+		}
+		attrs = append(attrs, r.constraints(property)...)
+
+		line := fmt.Sprintf("%s- %s (%s)", indent, name, strings.Join(attrs, ", "))
+		description, _ := property["description"].(string)
+		if resolved, _, _ := r.resolve(property, refs); description == "" {
+			description, _ = resolved["description"].(string)
+		}
+		if description != "" {
+			line += ": " + description
+		}
+		lines = append(lines, line)
+		lines = append(lines, r.propertyLines(property, depth+1, refs)...)
+	}
+	return lines
+}
+
+func (r schemaRenderer) constraints(schema map[string]any) []string {
+	schema, _, cyclic := r.resolve(schema, nil)
+	if cyclic {
+		return nil
+	}
+	constraints := []string{}
+	if values := anySlice(schema["enum"]); len(values) > 0 {
+		constraints = append(constraints, "one of "+jsonValues(values, ", "))
+	}
+	if value, ok := schema["default"]; ok {
+		constraints = append(constraints, "default "+jsonValues([]any{value}, ""))
+	}
+	if format, ok := schema["format"].(string); ok {
+		constraints = append(constraints, "format "+format)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		constraints = append(constraints, "pattern "+pattern)
+	}
+	for _, keyword := range []string{"minimum", "maximum", "minLength", "maxLength", "minItems", "maxItems"} {
+		if value, ok := schemaNumber(schema, keyword); ok {
+			constraints = append(constraints, fmt.Sprintf("%s %v", keyword, value))
+		}
+	}
+	return constraints
+}
+
+// propertyOrder returns the required properties in their order first, then the others sorted.
+func propertyOrder(properties map[string]any, required []string) []string {
+	names := []string{}
+	for _, name := range required {
+		if _, ok := properties[name]; ok {
+			names = append(names, name)
+		}
+	}
+	optional := []string{}
+	for name := range properties {
+		if !slices.Contains(names, name) {
+			optional = append(optional, name)
+		}
+	}
+	slices.Sort(optional)
+	return append(names, optional...)
+}
+
+func jsonValues(values []any, sep string) string {
+	rendered := []string{}
+	for _, value := range values {
+		data, err := json.Marshal(value)
+		if err != nil {
+			data = []byte(fmt.Sprint(value))
+		}
+		rendered = append(rendered, string(data))
+	}
+	return strings.Join(rendered, sep)
+}
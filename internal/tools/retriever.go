@@ -0,0 +1,284 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tmc/langchaingo/embeddings"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// ToolRetriever ranks the tools by relevance to the query, the most relevant first.
+type ToolRetriever interface {
+	Rank(ctx context.Context, query string, definitions []llms.FunctionDefinition) ([]string, error)
+}
+
+// ToolSelector exposes only the TopK most relevant tools plus the AlwaysOn ones.
+// A nil selector, zero TopK or no more than TopK tools selects every tool.
+type ToolSelector struct {
+	Retriever ToolRetriever
+	TopK      int
+	AlwaysOn  []string
+}
+
+// Select returns the names of the tools selected for the query, skipping the excluded ones.
+// The retrieval error is logged and every tool is selected then.
+func (s *ToolSelector) Select(ctx context.Context, e *ToolsExecutor, query string, exclude ...string) []string {
+	definitions := []llms.FunctionDefinition{}
+	for _, toolData := range e.Tools {
+		if slices.Contains(exclude, toolData.Definition.Name) {
+			continue
+		}
+		definitions = append(definitions, toolData.Definition)
+	}
+	slices.SortFunc(definitions, func(a, b llms.FunctionDefinition) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	names := []string{}
+	for _, def := range definitions {
+		names = append(names, def.Name)
+	}
+	if s == nil || s.Retriever == nil || s.TopK <= 0 || len(names) <= s.TopK {
+		return names
+	}
+
+	candidates := slices.DeleteFunc(slices.Clone(definitions), func(def llms.FunctionDefinition) bool {
+		return slices.Contains(s.AlwaysOn, def.Name)
+	})
+	ranked, err := s.Retriever.Rank(ctx, query, candidates)
+	if err != nil {
+		log.Warn().Err(err).Msg("tools retrieval, selecting every tool")
+		return names
+	}
+
+	selected := []string{}
+	for _, name := range names {
+		if slices.Contains(s.AlwaysOn, name) {
+			selected = append(selected, name)
+		}
+	}
+	selected = append(selected, ranked[:min(s.TopK, len(ranked))]...)
+	log.Debug().Strs("tools", selected).Msg("tools selection")
+	return selected
+}
+
+// SelectList returns the tools list of the tools selected for the query.
+func (s *ToolSelector) SelectList(ctx context.Context, e *ToolsExecutor, query string) []llms.Tool {
+	selected := s.Select(ctx, e, query)
+	return slices.DeleteFunc(e.ToolsList(), func(tool llms.Tool) bool {
+		return !slices.Contains(selected, tool.Function.Name)
+	})
+}
+
+// Unselected returns the names of the tools not selected for the query along with the excluded ones,
+// to be passed to the ToolsPromptDesc.
+func (s *ToolSelector) Unselected(ctx context.Context, e *ToolsExecutor, query string, exclude ...string) []string {
+	selected := s.Select(ctx, e, query, exclude...)
+	unselected := slices.Clone(exclude)
+	for name := range e.Tools {
+		if !slices.Contains(selected, name) && !slices.Contains(unselected, name) {
+			unselected = append(unselected, name)
+		}
+	}
+	return unselected
+}
+
+// toolDocument is the tool text indexed by the retrievers: name, description and parameter descriptions.
+func toolDocument(def llms.FunctionDefinition) string {
+	document := def.Name + "\n" + def.Description
+	var collect func(schema any)
+	collect = func(schema any) {
+		// The boolean or malformed schemas have no properties
+		schemaFields := schemaMap(schema)
+		if schemaFields == nil {
+			return
+		}
+		properties, _ := schemaFields["properties"].(map[string]any)
+		for name, property := range properties {
+			document += "\n" + name
+			if desc, ok := schemaMap(property)["description"].(string); ok {
+				document += " " + desc
+			}
+			collect(property)
+		}
+		collect(schemaFields["items"])
+	}
+	collect(def.Parameters)
+	return document
+}
+
+// KeywordRetriever ranks the tools by the BM25 score of the query terms over the tool documents.
+type KeywordRetriever struct{}
+
+func (KeywordRetriever) Rank(ctx context.Context, query string, definitions []llms.FunctionDefinition) ([]string, error) {
+	const k1, b = 1.2, 0.75
+
+	documents := [][]string{}
+	avgLength := 0.
+	frequencies := map[string]int{}
+	for _, def := range definitions {
+		terms := keywordTerms(toolDocument(def))
+		documents = append(documents, terms)
+		avgLength += float64(len(terms))
+		seen := map[string]bool{}
+		for _, term := range terms {
+			if !seen[term] {
+				seen[term] = true
+				frequencies[term]++
+			}
+		}
+	}
+	if len(documents) > 0 {
+		avgLength /= float64(len(documents))
+	}
+
+	queryTerms := slices.Compact(slices.Sorted(slices.Values(keywordTerms(query))))
+	scores := make([]float64, len(definitions))
+	for idx, terms := range documents {
+		for _, queryTerm := range queryTerms {
+			count := 0
+			for _, term := range terms {
+				if term == queryTerm {
+					count++
+				}
+			}
+			if count == 0 {
+				continue
+			}
+			n := float64(frequencies[queryTerm])
+			idf := math.Log(1 + (float64(len(documents))-n+0.5)/(n+0.5))
+			tf := float64(count) * (k1 + 1) /
+				(float64(count) + k1*(1-b+b*float64(len(terms))/max(avgLength, 1)))
+			scores[idx] += idf * tf
+		}
+	}
+
+	return rankByScores(definitions, scores), nil
+}
+
+// keywordTerms splits the text into lowercase terms, splitting the camelCase tool names as well.
+func keywordTerms(text string) []string {
+	terms := []string{}
+	term := []rune{}
+	flush := func() {
+		if len(term) > 1 {
+			terms = append(terms, strings.ToLower(string(term)))
+		}
+		term = term[:0]
+	}
+	var prev rune
+	for _, r := range text {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+		case unicode.IsUpper(r) && unicode.IsLower(prev):
+			flush()
+			term = append(term, r)
+		default:
+			term = append(term, r)
+		}
+		prev = r
+	}
+	flush()
+	return terms
+}
+
+// EmbeddingRetriever ranks the tools by the cosine similarity of the query and tool document embeddings.
+// The tool document embeddings are cached.
+type EmbeddingRetriever struct {
+	Embedder embeddings.Embedder
+
+	mu      sync.Mutex
+	vectors map[string][]float32
+}
+
+func (r *EmbeddingRetriever) Rank(ctx context.Context, query string, definitions []llms.FunctionDefinition) ([]string, error) {
+	documents := []string{}
+	for _, def := range definitions {
+		documents = append(documents, toolDocument(def))
+	}
+
+	r.mu.Lock()
+	missing := []string{}
+	for _, document := range documents {
+		if _, ok := r.vectors[document]; !ok {
+			missing = append(missing, document)
+		}
+	}
+	r.mu.Unlock()
+
+	if len(missing) > 0 {
+		vectors, err := r.Embedder.EmbedDocuments(ctx, missing)
+		if err != nil {
+			return nil, fmt.Errorf("embed tools: %w", err)
+		}
+		if len(vectors) != len(missing) {
+			return nil, fmt.Errorf("embed tools: got %d vectors for %d tools", len(vectors), len(missing))
+		}
+		r.mu.Lock()
+		if r.vectors == nil {
+			r.vectors = map[string][]float32{}
+		}
+		for idx, document := range missing {
+			r.vectors[document] = vectors[idx]
+		}
+		r.mu.Unlock()
+	}
+
+	queryVector, err := r.Embedder.EmbedQuery(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("embed query: %w", err)
+	}
+
+	scores := make([]float64, len(definitions))
+	r.mu.Lock()
+	for idx, document := range documents {
+		scores[idx] = cosineSimilarity(queryVector, r.vectors[document])
+	}
+	r.mu.Unlock()
+
+	return rankByScores(definitions, scores), nil
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	var dot, normA, normB float64
+	for idx := range min(len(a), len(b)) {
+		dot += float64(a[idx]) * float64(b[idx])
+		normA += float64(a[idx]) * float64(a[idx])
+		normB += float64(b[idx]) * float64(b[idx])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// rankByScores orders the tool names by the score descending, keeping the definitions order on ties.
+func rankByScores(definitions []llms.FunctionDefinition, scores []float64) []string {
+	indices := make([]int, len(definitions))
+	for idx := range indices {
+		indices[idx] = idx
+	}
+	slices.SortStableFunc(indices, func(a, b int) int {
+		switch {
+		case scores[a] > scores[b]:
+			return -1
+		case scores[a] < scores[b]:
+			return 1
+		}
+		return 0
+	})
+
+	names := []string{}
+	for _, idx := range indices {
+		names = append(names, definitions[idx].Name)
+	}
+	return names
+}
@@ -0,0 +1,198 @@
+package rewoo
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Swarmind/libagent/pkg/util"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tmc/langchaingo/llms"
+)
+
+type EvidenceMode string
+
+const (
+	// EvidenceSummarize summarizes the evidence chunks with respect to the step plan using LLM.
+	EvidenceSummarize EvidenceMode = "summarize"
+	// EvidenceFilter keeps the evidence chunks most relevant to the step plan, without LLM calls.
+	EvidenceFilter EvidenceMode = "filter"
+
+	DefaultEvidenceChunkSize = 4000
+)
+
+const PromptSummarizeEvidence = `Extract the information needed for the plan below from the tool output fragment.
+Keep exact values, names, URLs, numbers and code as is. Do not include any introductory phrases or explanations.
+If the fragment contains nothing relevant, respond with an empty string.
+Plan:
+%s
+
+Tool output fragment:
+%s
+`
+
+// ParseEvidenceMode parses "summarize" or "filter" into the EvidenceMode.
+func ParseEvidenceMode(mode string) (EvidenceMode, error) {
+	switch EvidenceMode(strings.ToLower(strings.TrimSpace(mode))) {
+	case "", EvidenceSummarize:
+		return EvidenceSummarize, nil
+	case EvidenceFilter:
+		return EvidenceFilter, nil
+	}
+	return "", fmt.Errorf("unknown evidence mode %q", mode)
+}
+
+// processEvidence compresses the evidence exceeding EvidenceMaxSize,
+// so it can be substituted into the later prompts.
+func (r ReWOO) processEvidence(ctx context.Context, step Step, evidence string) (string, error) {
+	if r.EvidenceMaxSize <= 0 || len(evidence) <= r.EvidenceMaxSize {
+		return evidence, nil
+	}
+
+	chunkSize := r.EvidenceChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultEvidenceChunkSize
+	}
+	chunks := splitEvidence(evidence, chunkSize)
+
+	processed := ""
+	switch r.EvidenceMode {
+	case EvidenceFilter:
+		processed = filterEvidence(step.Plan, chunks, r.EvidenceMaxSize)
+	default:
+		llm, options := r.worker()
+		summaries := []string{}
+		for _, chunk := range chunks {
+			response, err := llm.GenerateContent(ctx,
+				[]llms.MessageContent{
+					llms.TextParts(llms.ChatMessageTypeHuman,
+						fmt.Sprintf(PromptSummarizeEvidence, step.Plan, chunk),
+					)},
+				options...,
+			)
+			if err != nil {
+				return "", fmt.Errorf("summarize evidence: %w", err)
+			}
+			if len(response.Choices) == 0 {
+				continue
+			}
+			if summary := strings.TrimSpace(util.RemoveThinkTag(response.Choices[0].Content)); summary != "" {
+				summaries = append(summaries, summary)
+			}
+		}
+		processed = strings.Join(summaries, "\n")
+	}
+
+	if len(processed) > r.EvidenceMaxSize {
+		processed = strings.ToValidUTF8(processed[:r.EvidenceMaxSize], "") + "\n...(truncated)"
+	}
+
+	log.Debug().
+		Str("name", step.Name).
+		Str("mode", string(r.EvidenceMode)).
+		Int("raw_size", len(evidence)).
+		Int("size", len(processed)).
+		Msg("ReWOO: evidence compressed")
+
+	return processed, nil
+}
+
+// splitEvidence splits the evidence into chunks of at most size bytes, preferring line boundaries.
+func splitEvidence(evidence string, size int) []string {
+	chunks := []string{}
+	chunk := strings.Builder{}
+	for _, line := range strings.SplitAfter(evidence, "\n") {
+		for len(line) > size {
+			if chunk.Len() > 0 {
+				chunks = append(chunks, chunk.String())
+				chunk.Reset()
+			}
+			cut := runeCut(line, size)
+			chunks = append(chunks, line[:cut])
+			line = line[cut:]
+		}
+		if chunk.Len()+len(line) > size {
+			chunks = append(chunks, chunk.String())
+			chunk.Reset()
+		}
+		chunk.WriteString(line)
+	}
+	if chunk.Len() > 0 {
+		chunks = append(chunks, chunk.String())
+	}
+	return chunks
+}
+
+// runeCut moves the cut offset back to the rune start, so the multi-byte runes are not split,
+// or forward past the rune if it is longer than the offset.
+func runeCut(line string, offset int) int {
+	cut := offset
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	if cut > 0 {
+		return cut
+	}
+	cut = offset
+	for cut < len(line) && !utf8.RuneStart(line[cut]) {
+		cut++
+	}
+	return cut
+}
+
+// filterEvidence keeps the chunks sharing the most terms with the plan,
+// in their original order, within the maxSize budget.
+func filterEvidence(plan string, chunks []string, maxSize int) string {
+	planTerms := map[string]bool{}
+	for _, term := range evidenceTerms(plan) {
+		planTerms[term] = true
+	}
+
+	type scoredChunk struct {
+		idx   int
+		score int
+	}
+	scored := []scoredChunk{}
+	for idx, chunk := range chunks {
+		score := 0
+		for _, term := range evidenceTerms(chunk) {
+			if planTerms[term] {
+				score++
+			}
+		}
+		scored = append(scored, scoredChunk{idx: idx, score: score})
+	}
+	slices.SortStableFunc(scored, func(a, b scoredChunk) int {
+		return b.score - a.score
+	})
+
+	kept := []int{}
+	size := 0
+	for _, c := range scored {
+		if size+len(chunks[c.idx]) > maxSize && len(kept) > 0 {
+			continue
+		}
+		kept = append(kept, c.idx)
+		size += len(chunks[c.idx])
+	}
+	slices.Sort(kept)
+
+	parts := []string{}
+	for _, idx := range kept {
+		parts = append(parts, chunks[idx])
+	}
+	return strings.Join(parts, "\n...\n")
+}
+
+func evidenceTerms(text string) []string {
+	terms := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return slices.DeleteFunc(terms, func(term string) bool {
+		return len(term) < 3
+	})
+}
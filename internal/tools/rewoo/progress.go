@@ -0,0 +1,70 @@
+package rewoo
+
+import (
+	"context"
+)
+
+type ProgressEventType string
+
+const (
+	ProgressPlanReady    ProgressEventType = "plan_ready"
+	ProgressStepStarted  ProgressEventType = "step_started"
+	ProgressStepFinished ProgressEventType = "step_finished"
+	ProgressReplan       ProgressEventType = "replan"
+	ProgressSolved       ProgressEventType = "solved"
+)
+
+type ProgressStep struct {
+	Name string
+	Plan string
+	Tool string
+}
+
+// ProgressEvent describes the run progress, fields are filled depending on the event type:
+// Steps for plan_ready, Step for step_started and step_finished,
+// EvidenceSize, RawEvidenceSize and Error for step_finished, Attempt for replan, ResultSize for solved.
+type ProgressEvent struct {
+	Type  ProgressEventType
+	RunID string
+	Depth int
+
+	Steps []ProgressStep
+	Step  ProgressStep
+
+	EvidenceSize    int
+	RawEvidenceSize int
+	Error           string
+
+	Attempt    int
+	ResultSize int
+}
+
+type ProgressListener func(context.Context, ProgressEvent)
+
+type progressContextKey struct{}
+
+// ContextWithProgressListener sets the listener receiving the progress of the ReWOO runs called with the context.
+func ContextWithProgressListener(ctx context.Context, listener ProgressListener) context.Context {
+	return context.WithValue(ctx, progressContextKey{}, listener)
+}
+
+func (r ReWOO) emitProgress(ctx context.Context, state *State, event ProgressEvent) {
+	if state.Trace != nil {
+		event.RunID = state.Trace.RunID
+		event.Depth = state.Trace.Depth
+	}
+	if r.ProgressListener != nil {
+		r.ProgressListener(ctx, event)
+	}
+	if listener, ok := ctx.Value(progressContextKey{}).(ProgressListener); ok && listener != nil {
+		listener(ctx, event)
+	}
+}
+
+func progressStep(step Step) ProgressStep {
+	return ProgressStep{
+		Name: step.Name,
+		Plan: step.Plan,
+		Tool: step.Tool,
+	}
+}
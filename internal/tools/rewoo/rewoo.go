@@ -3,7 +3,9 @@ package rewoo
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
 	"regexp"
 	"slices"
 	"strings"
@@ -106,11 +108,86 @@ ToolCall arguments:
 %s
 `
 
+const PromptCallToolRetry = `
+The previous tool call attempt with arguments:
+%s
+failed with error:
+%s
+Resolve the arguments again, fixing the cause of the error.
+`
+
+const PromptMissingEvidence = `
+Some evidence could not be retrieved, do not rely on it:
+%s`
+
 type ReWOO struct {
 	LLM           *openai.LLM
 	ToolsExecutor *tools.ToolsExecutor
 
 	DefaultCallOptions []llms.CallOption
+
+	// Per-role models and call options, LLM is used for the empty models, the call options are merged
+	// over DefaultCallOptions per field, without the default model for the role LLM.
+	// Planner generates and regenerates plans, worker resolves tool arguments, solves LLM steps
+	// and compresses evidence, solver solves the task and observes the result.
+	PlannerLLM         *openai.LLM
+	PlannerCallOptions []llms.CallOption
+	WorkerLLM          *openai.LLM
+	WorkerCallOptions  []llms.CallOption
+	SolverLLM          *openai.LLM
+	SolverCallOptions  []llms.CallOption
+
+	// RetryPolicy is applied to failed tool steps, unless overridden for the step tool in ToolRetryPolicies.
+	RetryPolicy       RetryPolicy
+	ToolRetryPolicies map[string]RetryPolicy
+
+	// EvidenceMaxSize is the evidence length past which it is compressed before the substitution.
+	// Zero disables the compression.
+	EvidenceMaxSize   int
+	EvidenceMode      EvidenceMode
+	EvidenceChunkSize int
+
+	// ToolName is the name ReWOO is registered with in the ToolsExecutor, DefaultToolName if empty.
+	ToolName string
+	// AllowNested lets the planner schedule ReWOO itself, otherwise it is hidden from the plan.
+	AllowNested bool
+	// MaxDepth is the maximum number of nested run levels including the top one, DefaultMaxDepth if zero.
+	MaxDepth int
+
+	// ProgressListener receives the run progress events, along with the one set in the context.
+	ProgressListener ProgressListener
+
+	// ToolSelector, if set, limits the planner tools list to the ones relevant to the task.
+	ToolSelector *tools.ToolSelector
+}
+
+type RetryAction int
+
+const (
+	// RetrySkip leaves the step evidence missing.
+	RetrySkip RetryAction = iota
+	// RetrySame calls the tool again with the same arguments.
+	RetrySame
+	// RetryResolve asks the LLM to resolve the arguments again, providing the error as context.
+	RetryResolve
+)
+
+type RetryPolicy struct {
+	Action     RetryAction
+	MaxRetries int
+}
+
+// ParseRetryAction parses "skip", "same" or "resolve" into the RetryAction.
+func ParseRetryAction(action string) (RetryAction, error) {
+	switch strings.ToLower(strings.TrimSpace(action)) {
+	case "", "skip":
+		return RetrySkip, nil
+	case "same":
+		return RetrySame, nil
+	case "resolve":
+		return RetryResolve, nil
+	}
+	return RetrySkip, fmt.Errorf("unknown retry action %q", action)
 }
 
 type State struct {
@@ -119,8 +196,26 @@ type State struct {
 	PlanString string
 	Steps      []Step
 	Results    map[string]string
+	// RawResults keeps the uncompressed evidence for traces.
+	RawResults map[string]string
+	Errors     map[string]*StepError
 	SolvedPlan string
 	Result     string
+	Trace      *Trace
+}
+
+// StepError is a step which tool kept failing, so it has no evidence.
+type StepError struct {
+	Tool      string
+	Arguments string
+	Message   string
+	Attempts  int
+}
+
+func (e StepError) String() string {
+	return fmt.Sprintf("tool %s failed after %d attempt(s) with args %s: %s",
+		e.Tool, e.Attempts, e.Arguments, e.Message,
+	)
 }
 
 type Step struct {
@@ -130,10 +225,106 @@ type Step struct {
 	ToolInput string
 }
 
+// plannerTools renders the planner tools list for the task.
+func (r ReWOO) plannerTools(ctx context.Context, task string) string {
+	return r.ToolsExecutor.ToolsPromptDesc(
+		r.ToolSelector.Unselected(ctx, r.ToolsExecutor, task, r.hiddenTools(ctx)...)...,
+	)
+}
+
+func (r ReWOO) planner() (*openai.LLM, []llms.CallOption) {
+	return r.role(r.PlannerLLM, r.PlannerCallOptions)
+}
+
+func (r ReWOO) worker() (*openai.LLM, []llms.CallOption) {
+	return r.role(r.WorkerLLM, r.WorkerCallOptions)
+}
+
+func (r ReWOO) solver() (*openai.LLM, []llms.CallOption) {
+	return r.role(r.SolverLLM, r.SolverCallOptions)
+}
+
+// role merges the role call options over the DefaultCallOptions per field.
+// The default model option is dropped for the role LLM, as it is meant for the LLM.
+func (r ReWOO) role(llm *openai.LLM, options []llms.CallOption) (*openai.LLM, []llms.CallOption) {
+	defaults := r.DefaultCallOptions
+	if llm == nil {
+		llm = r.LLM
+	} else if len(defaults) > 0 {
+		defaults = []llms.CallOption{func(o *llms.CallOptions) {
+			model := o.Model
+			for _, option := range r.DefaultCallOptions {
+				option(o)
+			}
+			o.Model = model
+		}}
+	}
+	return llm, append(slices.Clone(defaults), options...)
+}
+
+// StepPattern matches the step up to its input opening bracket, the input is scanned by matchSteps.
 var StepPattern *regexp.Regexp = regexp.MustCompile(
-	`Plan:\s*(.+)\s*(#E\d+)\s*=\s*(\w+)\s*\[([^\]]+)\]`,
+	`Plan:\s*(.+)\s*(#E\d+)\s*=\s*(\w+)\s*\[`,
 )
 
+// matchSteps finds the plan steps as the full match, plan, name, tool and input submatches.
+// The input ends at its balanced closing bracket, so it can span lines and have the JSON arrays.
+func matchSteps(plan string) [][]string {
+	var matches [][]string
+	offset := 0
+	for {
+		loc := StepPattern.FindStringSubmatchIndex(plan[offset:])
+		if loc == nil {
+			return matches
+		}
+		inputStart := offset + loc[1]
+		inputEnd := closingBracket(plan[inputStart:], true)
+		if inputEnd < 0 {
+			// The unbalanced quote of the free text input
+			inputEnd = closingBracket(plan[inputStart:], false)
+		}
+		if inputEnd <= 0 {
+			offset = inputStart
+			continue
+		}
+		inputEnd += inputStart
+
+		match := []string{plan[offset+loc[0] : inputEnd+1]}
+		for group := 1; group <= 3; group++ {
+			match = append(match, plan[offset+loc[2*group]:offset+loc[2*group+1]])
+		}
+		matches = append(matches, append(match, plan[inputStart:inputEnd]))
+		offset = inputEnd + 1
+	}
+}
+
+// closingBracket returns the index of the bracket closing the already opened one, -1 if there is none.
+// The brackets inside the double quoted strings are skipped if quoted is set.
+func closingBracket(text string, quoted bool) int {
+	depth, inString, escaped := 1, false, false
+	for idx := 0; idx < len(text); idx++ {
+		switch char := text[idx]; {
+		case inString && escaped:
+			escaped = false
+		case inString && char == '\\':
+			escaped = true
+		case inString && char == '"':
+			inString = false
+		case inString:
+		case quoted && char == '"':
+			inString = true
+		case char == '[':
+			depth++
+		case char == ']':
+			depth--
+			if depth == 0 {
+				return idx
+			}
+		}
+	}
+	return -1
+}
+
 func (r ReWOO) InitializeGraph() (*graph.Runnable, error) {
 	workflowGraph := graph.NewStateGraph()
 
@@ -151,17 +342,18 @@ func (r ReWOO) GetPlan(ctx context.Context, s interface{}) (interface{}, error)
 	state := s.(*State)
 
 	if state.PlanString == "" {
-		response, err := r.LLM.GenerateContent(ctx,
+		llm, options := r.planner()
+		response, err := llm.GenerateContent(ctx,
 			[]llms.MessageContent{
 				llms.TextParts(llms.ChatMessageTypeHuman,
 					fmt.Sprintf(
 						"%s\nList of tools:\n%s\nTask:\n```\n%s```",
 						PromptGetPlan,
-						r.ToolsExecutor.ToolsPromptDesc(),
+						r.plannerTools(ctx, state.Task),
 						state.Task,
 					),
 				)},
-			r.DefaultCallOptions...,
+			options...,
 		)
 		if err != nil {
 			return s, err
@@ -170,7 +362,7 @@ func (r ReWOO) GetPlan(ctx context.Context, s interface{}) (interface{}, error)
 		state.PlanString = response.Choices[0].Content
 	}
 
-	matches := StepPattern.FindAllStringSubmatch(state.PlanString, -1)
+	matches := matchSteps(state.PlanString)
 	if matches == nil {
 		return s, fmt.Errorf("empty plan matches")
 	}
@@ -198,6 +390,15 @@ func (r ReWOO) GetPlan(ctx context.Context, s interface{}) (interface{}, error)
 		Interface("state.Steps", state.Steps).
 		Msg("ReWOO: GetPlan")
 
+	planSteps := []ProgressStep{}
+	for _, step := range state.Steps {
+		planSteps = append(planSteps, progressStep(step))
+	}
+	r.emitProgress(ctx, state, ProgressEvent{
+		Type:  ProgressPlanReady,
+		Steps: planSteps,
+	})
+
 	return state, nil
 }
 
@@ -205,10 +406,14 @@ func (r ReWOO) Solve(ctx context.Context, s interface{}) (interface{}, error) {
 	state := s.(*State)
 
 	state.SolvedPlan = ""
+	missingEvidence := ""
 	for _, step := range state.Steps {
-		for stepName, result := range state.Results {
-			step.ToolInput = strings.ReplaceAll(step.ToolInput, stepName, result)
-			step.Name = strings.ReplaceAll(step.Name, stepName, result)
+		if stepErr, ok := state.Errors[step.Name]; ok {
+			missingEvidence += fmt.Sprintf("- %s: %s\n", step.Name, stepErr)
+		}
+		for _, stepName := range sortedResultNames(state.Results) {
+			step.ToolInput = strings.ReplaceAll(step.ToolInput, stepName, state.Results[stepName])
+			step.Name = strings.ReplaceAll(step.Name, stepName, state.Results[stepName])
 		}
 		state.SolvedPlan += fmt.Sprintf(
 			"Plan: %s\n%s = %s[%s]\n",
@@ -218,12 +423,16 @@ func (r ReWOO) Solve(ctx context.Context, s interface{}) (interface{}, error) {
 			step.ToolInput,
 		)
 	}
-	response, err := r.LLM.GenerateContent(ctx,
+	if missingEvidence != "" {
+		state.SolvedPlan += fmt.Sprintf(PromptMissingEvidence, missingEvidence)
+	}
+	llm, options := r.solver()
+	response, err := llm.GenerateContent(ctx,
 		[]llms.MessageContent{
 			llms.TextParts(llms.ChatMessageTypeHuman,
 				fmt.Sprintf(PromptSolver, state.SolvedPlan, state.Task),
 			)},
-		r.DefaultCallOptions...,
+		options...,
 	)
 	if err != nil {
 		return state, err
@@ -234,6 +443,11 @@ func (r ReWOO) Solve(ctx context.Context, s interface{}) (interface{}, error) {
 		Str("state.Result", state.Result).
 		Msg("ReWOO: Solve")
 
+	r.emitProgress(ctx, state, ProgressEvent{
+		Type:       ProgressSolved,
+		ResultSize: len(state.Result),
+	})
+
 	return state, nil
 }
 
@@ -241,14 +455,178 @@ func (r ReWOO) ToolExecution(ctx context.Context, s interface{}) (interface{}, e
 	state := s.(*State)
 
 	step := state.Steps[getCurrentTask(state)]
+	r.emitProgress(ctx, state, ProgressEvent{
+		Type: ProgressStepStarted,
+		Step: progressStep(step),
+	})
+
+	content, callErr, ok := r.directToolCall(ctx, step, state)
+	if !ok {
+		var err error
+		content, callErr, err = r.resolveToolCall(ctx, step, state, nil)
+		if err != nil {
+			return state, err
+		}
+	}
+
+	policy := r.retryPolicy(step.Tool)
+	attempts := 1
+	for callErr != nil && policy.Action != RetrySkip && attempts <= policy.MaxRetries {
+		log.Warn().
+			Err(callErr).
+			Str("name", step.Name).
+			Int("attempt", attempts).
+			Msg("ReWOO: ToolExecution retry")
+		attempts++
+
+		switch policy.Action {
+		case RetrySame:
+			content, callErr = r.callTool(ctx, callErr.Tool, callErr.Arguments)
+		case RetryResolve:
+			var err error
+			content, callErr, err = r.resolveToolCall(ctx, step, state, callErr)
+			if err != nil {
+				return state, err
+			}
+		}
+	}
+
+	if callErr != nil {
+		if len(state.Errors) == 0 {
+			state.Errors = map[string]*StepError{}
+		}
+		state.Errors[step.Name] = &StepError{
+			Tool:      callErr.Tool,
+			Arguments: callErr.Arguments,
+			Message:   callErr.Err.Error(),
+			Attempts:  attempts,
+		}
+		log.Warn().
+			Err(callErr).
+			Str("name", step.Name).
+			Int("attempts", attempts).
+			Msg("ReWOO: ToolExecution step failed")
+		r.emitProgress(ctx, state, ProgressEvent{
+			Type:  ProgressStepFinished,
+			Step:  progressStep(step),
+			Error: state.Errors[step.Name].Message,
+		})
+		return state, nil
+	}
 
-	for stepName, result := range state.Results {
-		step.ToolInput = strings.ReplaceAll(step.ToolInput, stepName, result)
+	if len(state.Results) == 0 {
+		state.Results = map[string]string{}
+	}
+	if len(state.RawResults) == 0 {
+		state.RawResults = map[string]string{}
+	}
+	content = util.RemoveThinkTag(content)
+	state.RawResults[step.Name] = content
+
+	evidence, err := r.processEvidence(ctx, step, content)
+	if err != nil {
+		return state, err
+	}
+	jsonSafeContent, err := json.Marshal(evidence)
+	if err != nil {
+		return state, err
+	}
+
+	state.Results[step.Name] = string(jsonSafeContent)
+	r.emitProgress(ctx, state, ProgressEvent{
+		Type:            ProgressStepFinished,
+		Step:            progressStep(step),
+		EvidenceSize:    len(evidence),
+		RawEvidenceSize: len(content),
+	})
+	return state, nil
+}
+
+func (r ReWOO) retryPolicy(tool string) RetryPolicy {
+	if policy, ok := r.ToolRetryPolicies[tool]; ok {
+		return policy
+	}
+	return r.RetryPolicy
+}
+
+func (r ReWOO) callTool(ctx context.Context, tool, args string) (string, *tools.ToolCallError) {
+	content, err := r.ToolsExecutor.CallTool(ctx, tool, args)
+	if err != nil {
+		return "", &tools.ToolCallError{
+			Tool:      tool,
+			Arguments: args,
+			Err:       err,
+		}
+	}
+	return content, nil
+}
+
+// directToolCall calls the step tool without LLM arguments resolution
+// if the substituted step input already satisfies the tool parameters schema.
+func (r ReWOO) directToolCall(ctx context.Context, step Step, state *State) (string, *tools.ToolCallError, bool) {
+	if step.Tool == "LLM" {
+		return "", nil, false
+	}
+	for stepName := range state.Errors {
+		if referencesStep(step.ToolInput, stepName) {
+			return "", nil, false
+		}
+	}
+	toolData, err := r.ToolsExecutor.GetTool(step.Tool)
+	if err != nil {
+		return "", nil, false
+	}
+	args, ok := substituteJSONInput(step.ToolInput, state.Results)
+	if !ok {
+		return "", nil, false
+	}
+	if err := validateDirectInput(toolData.Definition, args); err != nil {
+		log.Debug().
+			Err(err).
+			Str("name", step.Name).
+			Str("tool", step.Tool).
+			Str("args", args).
+			Msg("ReWOO: ToolExecution direct call rejected")
+		return "", nil, false
+	}
+
+	content, callErr := r.callTool(ctx, step.Tool, args)
+	event := log.Debug().
+		Str("name", step.Name).
+		Str("tool", step.Tool).
+		Str("args", args).
+		Str("content", content)
+	if callErr != nil {
+		event = event.Err(callErr)
+	}
+	event.Msg("ReWOO: ToolExecution direct call")
+
+	return content, callErr, true
+}
+
+// resolveToolCall asks the LLM to turn the step input into the tool call,
+// or to solve the step itself for the LLM tool.
+// The previous failed call, if any, is provided to the LLM as context.
+func (r ReWOO) resolveToolCall(
+	ctx context.Context,
+	step Step,
+	state *State,
+	previousErr *tools.ToolCallError,
+) (string, *tools.ToolCallError, error) {
+	// The results and the errors are substituted together, so the longer names go first across both
+	substitutions := maps.Clone(state.Results)
+	if substitutions == nil {
+		substitutions = map[string]string{}
+	}
+	for stepName, stepErr := range state.Errors {
+		substitutions[stepName] = fmt.Sprintf("(%s evidence is missing: %s)", stepName, stepErr.Message)
+	}
+	for _, stepName := range sortedResultNames(substitutions) {
+		step.ToolInput = strings.ReplaceAll(step.ToolInput, stepName, substitutions[stepName])
 	}
 
 	prompt := fmt.Sprintf(PromptLLMTool, step.ToolInput)
 	options := []llms.CallOption{}
-	content := ""
 	if step.Tool != "LLM" {
 		toolDesc := ""
 		if toolData, err := r.ToolsExecutor.GetTool(step.Tool); err == nil {
@@ -273,7 +651,7 @@ func (r ReWOO) ToolExecution(ctx context.Context, s interface{}) (interface{}, e
 					string(commandExecutorQueryBytes),
 				)
 				if err != nil {
-					return state, fmt.Errorf("pwd command: %w", err)
+					return "", nil, fmt.Errorf("pwd command: %w", err)
 				}
 
 				toolDesc += fmt.Sprintf("Current directory and contents for execution context, "+
@@ -288,6 +666,9 @@ func (r ReWOO) ToolExecution(ctx context.Context, s interface{}) (interface{}, e
 			toolDesc,
 			step.ToolInput,
 		)
+		if previousErr != nil {
+			prompt += fmt.Sprintf(PromptCallToolRetry, previousErr.Arguments, previousErr.Err)
+		}
 	}
 
 	log.Debug().
@@ -296,9 +677,10 @@ func (r ReWOO) ToolExecution(ctx context.Context, s interface{}) (interface{}, e
 		Str("prompt", prompt).
 		Msg("ReWOO: ToolExecution pre-GenerateContent")
 
-	options = append(r.DefaultCallOptions, options...)
+	llm, defaultOptions := r.worker()
+	options = slices.Concat(defaultOptions, options)
 
-	response, err := r.LLM.GenerateContent(ctx,
+	response, err := llm.GenerateContent(ctx,
 		[]llms.MessageContent{
 			llms.TextParts(llms.ChatMessageTypeHuman,
 				prompt,
@@ -306,12 +688,17 @@ func (r ReWOO) ToolExecution(ctx context.Context, s interface{}) (interface{}, e
 		options...,
 	)
 	if err != nil {
-		return state, err
+		return "", nil, err
 	}
-	content = response.Choices[0].Content
-	if toolContent := r.ToolsExecutor.ProcessToolCalls(
+	content := response.Choices[0].Content
+	toolContent, err := r.ToolsExecutor.ExecuteToolCalls(
 		ctx, response.Choices[0].ToolCalls,
-	); toolContent != "" {
+	)
+	callErr := &tools.ToolCallError{}
+	if !errors.As(err, &callErr) {
+		callErr = nil
+	}
+	if toolContent != "" {
 		content = toolContent
 	}
 	log.Debug().
@@ -319,18 +706,10 @@ func (r ReWOO) ToolExecution(ctx context.Context, s interface{}) (interface{}, e
 		Str("tool", step.Tool).
 		Str("prompt", prompt).
 		Str("content", content).
+		AnErr("error", err).
 		Msg("ReWOO: ToolExecution")
 
-	if len(state.Results) == 0 {
-		state.Results = map[string]string{}
-	}
-	jsonSafeContent, err := json.Marshal(util.RemoveThinkTag(content))
-	if err != nil {
-		return state, err
-	}
-
-	state.Results[step.Name] = string(jsonSafeContent)
-	return state, nil
+	return content, callErr, nil
 }
 
 func (_ ReWOO) Route(ctx context.Context, state interface{}) string {
@@ -351,12 +730,13 @@ func (r ReWOO) ObserveEnd(ctx context.Context, s interface{}) string {
 	}
 
 	decisionMarker := uuid.New().String()
-	response, err := r.LLM.GenerateContent(ctx,
+	solverLLM, solverOptions := r.solver()
+	response, err := solverLLM.GenerateContent(ctx,
 		[]llms.MessageContent{
 			llms.TextParts(llms.ChatMessageTypeHuman,
 				fmt.Sprintf(PromptDecision, decisionMarker, state.Task, state.PlanString, state.SolvedPlan),
 			)},
-		r.DefaultCallOptions...,
+		solverOptions...,
 	)
 	if err != nil {
 		log.Warn().Err(err).Msg("generate decision observe response")
@@ -374,19 +754,20 @@ func (r ReWOO) ObserveEnd(ctx context.Context, s interface{}) string {
 	if strings.Contains(util.RemoveThinkTag(content), decisionMarker) {
 		return graph.END
 	}
-	response, err = r.LLM.GenerateContent(ctx,
+	plannerLLM, plannerOptions := r.planner()
+	response, err = plannerLLM.GenerateContent(ctx,
 		[]llms.MessageContent{
 			llms.TextParts(llms.ChatMessageTypeHuman,
 				fmt.Sprintf(PromptRegeneratePlan,
 					fmt.Sprintf(
 						"%s\nList of tools:\n%s\nTask:\n",
 						PromptGetPlan,
-						r.ToolsExecutor.ToolsPromptDesc(),
+						r.plannerTools(ctx, state.Task),
 					),
 					state.Task, state.SolvedPlan,
 				),
 			)},
-		r.DefaultCallOptions...,
+		plannerOptions...,
 	)
 	if err != nil {
 		log.Warn().Err(err).Msg("generate plan regeneration response")
@@ -400,27 +781,136 @@ func (r ReWOO) ObserveEnd(ctx context.Context, s interface{}) string {
 	state.SolvedPlan = ""
 	state.Steps = []Step{}
 	state.Results = map[string]string{}
+	state.RawResults = map[string]string{}
+	state.Errors = map[string]*StepError{}
 	log.Debug().
 		Str("new_plan", state.PlanString).
 		Msg("ReWOO.ObserveEnd")
 	state.Attempt += 1
-	matches := StepPattern.FindAllStringSubmatch(state.PlanString, -1)
+	matches := matchSteps(state.PlanString)
 	if matches == nil {
 		log.Warn().Msg("ReWOO.ObserveEnd - empty matches in the new plan")
 		return graph.END
 	}
 
-	err = r.ToolsExecutor.Cleanup()
+	// Only the tools session state is reset, the shared executor tools resources are kept
+	err = r.ToolsExecutor.Reset(ctx)
 	if err != nil {
-		log.Warn().Err(err).Msg("cleanup at plan regeneration")
+		log.Warn().Err(err).Msg("reset at plan regeneration")
 	}
 
+	r.emitProgress(ctx, state, ProgressEvent{
+		Type:    ProgressReplan,
+		Attempt: state.Attempt,
+	})
+
 	return GraphPlanName
 }
 
+// substituteJSONInput parses the step input as a JSON object and substitutes
+// evidence variables inside its string values with the raw evidence text.
+func substituteJSONInput(input string, results map[string]string) (string, bool) {
+	args := map[string]any{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(input)), &args); err != nil {
+		return "", false
+	}
+
+	evidence := map[string]string{}
+	for stepName, result := range results {
+		raw := ""
+		if err := json.Unmarshal([]byte(result), &raw); err != nil {
+			raw = result
+		}
+		evidence[stepName] = raw
+	}
+	names := sortedResultNames(results)
+
+	var substitute func(v any) any
+	substitute = func(v any) any {
+		switch val := v.(type) {
+		case string:
+			for _, stepName := range names {
+				val = strings.ReplaceAll(val, stepName, evidence[stepName])
+			}
+			return val
+		case []any:
+			for i := range val {
+				val[i] = substitute(val[i])
+			}
+			return val
+		case map[string]any:
+			for k := range val {
+				val[k] = substitute(val[k])
+			}
+			return val
+		}
+		return v
+	}
+	substitute(args)
+
+	argsBytes, err := json.Marshal(args)
+	if err != nil {
+		return "", false
+	}
+	return string(argsBytes), true
+}
+
+// validateDirectInput is stricter than the schema validation: unknown properties
+// usually mean that the planner confused the tool schema, so the LLM should resolve it.
+func validateDirectInput(def llms.FunctionDefinition, args string) error {
+	if def.Parameters == nil {
+		return fmt.Errorf("tool has no parameters schema")
+	}
+	if err := tools.ValidateArguments(def, args); err != nil {
+		return err
+	}
+
+	schema, _ := def.Parameters.(map[string]any)
+	props, _ := schema["properties"].(map[string]any)
+	value := map[string]any{}
+	if err := json.Unmarshal([]byte(args), &value); err != nil {
+		return err
+	}
+	if len(value) == 0 && len(props) > 0 {
+		return fmt.Errorf("empty arguments")
+	}
+	for name := range value {
+		if _, ok := props[name]; !ok {
+			return fmt.Errorf("unknown property %q", name)
+		}
+	}
+	return nil
+}
+
+// referencesStep reports whether the input references the step evidence, #E1 does not match the #E10.
+func referencesStep(input, stepName string) bool {
+	return regexp.MustCompile(regexp.QuoteMeta(stepName) + `\b`).MatchString(input)
+}
+
+// sortedResultNames returns evidence names longest first, so #E1 does not replace the #E10 prefix.
+func sortedResultNames(results map[string]string) []string {
+	names := []string{}
+	for stepName := range results {
+		names = append(names, stepName)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		if len(a) != len(b) {
+			return len(b) - len(a)
+		}
+		return strings.Compare(a, b)
+	})
+	return names
+}
+
 func getCurrentTask(state *State) int {
-	if len(state.Results) == len(state.Steps) {
-		return -1
+	for idx, step := range state.Steps {
+		if _, ok := state.Results[step.Name]; ok {
+			continue
+		}
+		if _, ok := state.Errors[step.Name]; ok {
+			continue
+		}
+		return idx
 	}
-	return len(state.Results)
+	return -1
 }
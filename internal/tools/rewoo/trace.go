@@ -0,0 +1,144 @@
+package rewoo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Swarmind/libagent/internal/tools"
+
+	graph "github.com/JackBekket/langgraphgo/graph/stategraph"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultToolName = "rewoo"
+	DefaultMaxDepth = 2
+)
+
+// Trace is a ReWOO run record, nested runs are attached to the parent run trace as children.
+type Trace struct {
+	RunID       string
+	ParentRunID string
+	Depth       int
+	Task        string
+	StartedAt   time.Time
+	FinishedAt  time.Time
+	Result      string
+	Error       string
+
+	mu       sync.Mutex
+	children []*Trace
+}
+
+func (t *Trace) Children() []*Trace {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*Trace{}, t.children...)
+}
+
+func (t *Trace) addChild(child *Trace) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.children = append(t.children, child)
+}
+
+type traceContextKey struct{}
+type traceHandlerContextKey struct{}
+
+// ContextWithTraceHandler sets the handler receiving the trace tree of every finished top level run.
+func ContextWithTraceHandler(ctx context.Context, handler func(*Trace)) context.Context {
+	return context.WithValue(ctx, traceHandlerContextKey{}, handler)
+}
+
+// TraceFromContext returns the trace of the ReWOO run the context belongs to, if any.
+func TraceFromContext(ctx context.Context) *Trace {
+	trace, _ := ctx.Value(traceContextKey{}).(*Trace)
+	return trace
+}
+
+func (r ReWOO) toolName() string {
+	if r.ToolName == "" {
+		return DefaultToolName
+	}
+	return r.ToolName
+}
+
+func (r ReWOO) maxDepth() int {
+	if r.MaxDepth <= 0 {
+		return DefaultMaxDepth
+	}
+	return r.MaxDepth
+}
+
+// hiddenTools are the tools excluded from the planner tools list.
+// The readMore tool is always hidden, as the output handles are unknown at the planning time.
+func (r ReWOO) hiddenTools(ctx context.Context) []string {
+	hidden := []string{tools.ReadMoreToolName}
+	if !r.AllowNested {
+		return append(hidden, r.toolName())
+	}
+	if trace := TraceFromContext(ctx); trace != nil && trace.Depth+1 >= r.maxDepth() {
+		return append(hidden, r.toolName())
+	}
+	return hidden
+}
+
+// Invoke runs the graph for the task as a new run, nested into the context run if there is one.
+func (r ReWOO) Invoke(ctx context.Context, g *graph.Runnable, task string) (*State, error) {
+	trace := &Trace{
+		RunID:     uuid.New().String(),
+		Task:      task,
+		StartedAt: time.Now(),
+	}
+	if parent := TraceFromContext(ctx); parent != nil {
+		if !r.AllowNested {
+			return nil, fmt.Errorf("nested %s run is not allowed", r.toolName())
+		}
+		if parent.Depth+1 >= r.maxDepth() {
+			return nil, fmt.Errorf("%s max nesting depth %d reached", r.toolName(), r.maxDepth())
+		}
+		trace.ParentRunID = parent.RunID
+		trace.Depth = parent.Depth + 1
+		parent.addChild(trace)
+	}
+	ctx = context.WithValue(ctx, traceContextKey{}, trace)
+	// The audited tool calls are attributed to the top level run, unless the caller has set the run ID
+	if tools.RunIDFromContext(ctx) == "" {
+		ctx = tools.ContextWithRunID(ctx, trace.RunID)
+	}
+
+	log.Debug().
+		Str("run_id", trace.RunID).
+		Str("parent_run_id", trace.ParentRunID).
+		Int("depth", trace.Depth).
+		Msg("ReWOO: run started")
+
+	state := &State{
+		Task:  task,
+		Trace: trace,
+	}
+	_, err := g.Invoke(ctx, state)
+
+	trace.FinishedAt = time.Now()
+	trace.Result = state.Result
+	if err != nil {
+		trace.Error = err.Error()
+	}
+	log.Debug().
+		Str("run_id", trace.RunID).
+		Str("parent_run_id", trace.ParentRunID).
+		Int("depth", trace.Depth).
+		Dur("duration", trace.FinishedAt.Sub(trace.StartedAt)).
+		Int("children", len(trace.Children())).
+		AnErr("error", err).
+		Msg("ReWOO: run finished")
+
+	if handler, ok := ctx.Value(traceHandlerContextKey{}).(func(*Trace)); ok && trace.ParentRunID == "" {
+		handler(trace)
+	}
+
+	return state, err
+}
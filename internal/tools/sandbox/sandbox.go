@@ -0,0 +1,76 @@
+package sandbox
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrUnsupported = errors.New("command sandbox is only supported on linux")
+
+// Options of the sandbox namespaces and resource limits, the zero limits are not set.
+type Options struct {
+	// Network keeps the host network, otherwise the sandbox has only the loopback interface.
+	Network bool
+
+	// CPUTime, Memory (address space bytes), Processes and FileSize (bytes) are set as the shell rlimits.
+	CPUTime   time.Duration
+	Memory    int64
+	Processes int
+	FileSize  int64
+
+	// Cgroup is the parent cgroup v2 directory, delegated to the process user, where the sandbox cgroup
+	// is created with the memory.max, pids.max and cpu.max (CPUQuota as the CPUs count) limits.
+	Cgroup   string
+	CPUQuota float64
+
+	// TmpSize is the sandbox /tmp tmpfs size in bytes, 64MiB if zero.
+	TmpSize int64
+}
+
+const defaultTmpSize = 64 << 20
+
+// setupScript runs in the new user, mount, PID (and network) namespaces as the namespace root.
+// It builds the read-only view of the host root with the fresh /proc, minimal /dev, tmpfs /tmp
+// and the writable workspace and state directories, then drops all the capabilities, so the mounts can not be changed,
+// and runs the command chrooted in the workspace with the clean environment.
+const setupScript = `set -eu
+root=$SANDBOX_ROOT
+workspace=$SANDBOX_WORKSPACE
+
+mount --make-rprivate /
+mount --rbind / "$root"
+awk -v root="$root" '$2 == root || index($2, root "/") == 1 { print $2 }' /proc/self/mounts |
+	while read -r target; do
+		mount -o remount,bind,ro "$target"
+	done
+
+mount -t proc -o nosuid,nodev,noexec proc "$root/proc"
+
+mount -t tmpfs -o mode=755,size=1m,nosuid tmpfs "$root/dev"
+for dev in null zero full random urandom tty; do
+	touch "$root/dev/$dev"
+	mount --bind "/dev/$dev" "$root/dev/$dev"
+done
+ln -s /proc/self/fd "$root/dev/fd"
+ln -s /proc/self/fd/0 "$root/dev/stdin"
+ln -s /proc/self/fd/1 "$root/dev/stdout"
+ln -s /proc/self/fd/2 "$root/dev/stderr"
+mkdir "$root/dev/shm"
+mount -o remount,bind,ro "$root/dev"
+
+mount -t tmpfs -o "mode=1777,size=$SANDBOX_TMP_SIZE,nosuid,nodev" tmpfs "$root/tmp"
+for dir in "$workspace" "$SANDBOX_STATE"; do
+	mkdir -p "$root$dir"
+	mount --bind "$dir" "$root$dir"
+done
+
+if [ "$SANDBOX_NETWORK" = 0 ]; then
+	ip link set lo up 2>/dev/null || true
+fi
+
+if [ -n "$SANDBOX_ULIMITS" ]; then
+	ulimit $SANDBOX_ULIMITS
+fi
+exec chroot "$root" setpriv --bounding-set=-all --inh-caps=-all --no-new-privs -- \
+	env -i HOME="$workspace" PATH="$SANDBOX_PATH" PS1='$ ' sh -c 'cd "$HOME" && exec "$@"' sh "$@"
+`
@@ -0,0 +1,199 @@
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// Sandbox is the session directory with the workspace and the sandbox root mount point,
+// and the cgroup of the sandboxed processes if configured.
+// State is the writable directory of the caller files shared with the sandbox, e.g. the commands stderr.
+type Sandbox struct {
+	Options   Options
+	Dir       string
+	Workspace string
+	State     string
+
+	cgroup   string
+	cgroupFD int
+}
+
+// New creates the session directory and the cgroup, the commands are started with Command.
+func New(opts Options) (*Sandbox, error) {
+	for _, tool := range []string{"mount", "chroot", "setpriv"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return nil, fmt.Errorf("sandbox requires %s: %w", tool, err)
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "libagent_command_sandbox_")
+	if err != nil {
+		return nil, err
+	}
+	s := &Sandbox{
+		Options:   opts,
+		Dir:       dir,
+		Workspace: filepath.Join(dir, "workspace"),
+		State:     filepath.Join(dir, "state"),
+	}
+	for _, path := range []string{s.Workspace, s.State, s.root()} {
+		if err := os.Mkdir(path, 0o755); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	if opts.Cgroup != "" {
+		if err := s.createCgroup(); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Sandbox) root() string {
+	return filepath.Join(s.Dir, "root")
+}
+
+// Command returns the not started command running the args in the sandbox workspace.
+func (s *Sandbox) Command(args ...string) (*exec.Cmd, error) {
+	cmd := exec.Command("bash", append([]string{"-c", setupScript, "sandbox"}, args...)...)
+	tmpSize := s.Options.TmpSize
+	if tmpSize <= 0 {
+		tmpSize = defaultTmpSize
+	}
+	network := "0"
+	if s.Options.Network {
+		network = "1"
+	}
+	cmd.Env = []string{
+		"PATH=" + os.Getenv("PATH"),
+		"SANDBOX_ROOT=" + s.root(),
+		"SANDBOX_WORKSPACE=" + s.Workspace,
+		"SANDBOX_STATE=" + s.State,
+		"SANDBOX_PATH=" + os.Getenv("PATH"),
+		"SANDBOX_NETWORK=" + network,
+		"SANDBOX_TMP_SIZE=" + strconv.FormatInt(tmpSize, 10),
+		"SANDBOX_ULIMITS=" + s.ulimits(),
+	}
+
+	cloneflags := uintptr(syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID |
+		syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS)
+	if !s.Options.Network {
+		cloneflags |= syscall.CLONE_NEWNET
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: cloneflags,
+		// The namespace root is the process user
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+		GidMappingsEnableSetgroups: false,
+	}
+	if s.cgroup != "" {
+		// Started right in the cgroup, so the limits apply from the first instruction
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = s.cgroupFD
+	}
+	return cmd, nil
+}
+
+// ulimits are the bash ulimit arguments, in KiB for the sizes.
+func (s *Sandbox) ulimits() string {
+	limits := []string{}
+	if s.Options.CPUTime > 0 {
+		limits = append(limits, fmt.Sprintf("-t %d", max(int64(s.Options.CPUTime.Seconds()), 1)))
+	}
+	if s.Options.Memory > 0 {
+		limits = append(limits, fmt.Sprintf("-v %d", max(s.Options.Memory>>10, 1)))
+	}
+	if s.Options.Processes > 0 {
+		limits = append(limits, fmt.Sprintf("-u %d", s.Options.Processes))
+	}
+	if s.Options.FileSize > 0 {
+		limits = append(limits, fmt.Sprintf("-f %d", max(s.Options.FileSize>>10, 1)))
+	}
+	return strings.Join(limits, " ")
+}
+
+func (s *Sandbox) createCgroup() error {
+	s.cgroup = filepath.Join(s.Options.Cgroup, "libagent-"+uuid.New().String())
+	if err := os.Mkdir(s.cgroup, 0o755); err != nil {
+		s.cgroup = ""
+		return fmt.Errorf("create sandbox cgroup: %w", err)
+	}
+
+	fd, err := syscall.Open(s.cgroup, syscall.O_DIRECTORY|syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("open sandbox cgroup: %w", err)
+	}
+	s.cgroupFD = fd
+
+	limits := map[string]string{}
+	if s.Options.Memory > 0 {
+		limits["memory.max"] = strconv.FormatInt(s.Options.Memory, 10)
+		limits["memory.swap.max"] = "0"
+	}
+	if s.Options.Processes > 0 {
+		limits["pids.max"] = strconv.Itoa(s.Options.Processes)
+	}
+	if s.Options.CPUQuota > 0 {
+		const period = 100000
+		limits["cpu.max"] = fmt.Sprintf("%d %d", int64(s.Options.CPUQuota*period), period)
+	}
+	for file, value := range limits {
+		err := os.WriteFile(filepath.Join(s.cgroup, file), []byte(value), 0o644)
+		// The swap limit file is missing without the swap accounting
+		if err != nil && !(file == "memory.swap.max" && errors.Is(err, os.ErrNotExist)) {
+			return fmt.Errorf("set sandbox cgroup %s (is the controller enabled in the parent?): %w", file, err)
+		}
+	}
+	return nil
+}
+
+// Close kills the sandbox cgroup processes and removes the cgroup and the session directory.
+// The sandbox shell itself is expected to be killed by the caller, taking its PID namespace down.
+func (s *Sandbox) Close() error {
+	errs := []error{}
+	if s.cgroup != "" {
+		if s.cgroupFD > 0 {
+			syscall.Close(s.cgroupFD)
+			s.cgroupFD = 0
+		}
+		if err := removeCgroup(s.cgroup); err != nil {
+			errs = append(errs, err)
+		}
+		s.cgroup = ""
+	}
+	if s.Dir != "" {
+		if err := os.RemoveAll(s.Dir); err != nil {
+			errs = append(errs, err)
+		}
+		s.Dir = ""
+	}
+	return errors.Join(errs...)
+}
+
+func removeCgroup(cgroup string) error {
+	if err := os.WriteFile(filepath.Join(cgroup, "cgroup.kill"), []byte("1"), 0o644); err != nil {
+		log.Debug().Err(err).Msg("sandbox cgroup kill")
+	}
+	// The killed processes leave the cgroup asynchronously
+	var err error
+	for range 50 {
+		if err = os.Remove(cgroup); err == nil || errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return fmt.Errorf("remove sandbox cgroup: %w", err)
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package sandbox
+
+import "os/exec"
+
+type Sandbox struct {
+	Options   Options
+	Dir       string
+	Workspace string
+	State     string
+}
+
+func New(opts Options) (*Sandbox, error) {
+	return nil, ErrUnsupported
+}
+
+func (s *Sandbox) Command(args ...string) (*exec.Cmd, error) {
+	return nil, ErrUnsupported
+}
+
+func (s *Sandbox) Close() error {
+	return nil
+}
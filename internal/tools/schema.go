@@ -0,0 +1,308 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// ValidationIssue is a single schema violation at the JSON path of the arguments.
+type ValidationIssue struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned for the tool call arguments not satisfying the tool parameters schema.
+// Its message is meant to be read by the model, so it could correct the call.
+type ValidationError struct {
+	Tool   string
+	Issues []ValidationIssue
+}
+
+func (e *ValidationError) Error() string {
+	issues := []string{}
+	for _, issue := range e.Issues {
+		issues = append(issues, fmt.Sprintf("%s: %s", issue.Path, issue.Message))
+	}
+	return fmt.Sprintf("invalid arguments for tool %s: %s", e.Tool, strings.Join(issues, "; "))
+}
+
+// ValidateArguments checks that args is a JSON object satisfying the definition parameters schema.
+// Supported keywords are type, properties, required, additionalProperties, items, enum, const,
+// pattern, minLength, maxLength, minimum, maximum, minItems and maxItems.
+// The returned error is *ValidationError.
+func ValidateArguments(def llms.FunctionDefinition, args string) error {
+	schema := schemaMap(def.Parameters)
+	if schema == nil {
+		return nil
+	}
+
+	validationErr := &ValidationError{Tool: def.Name}
+	value := map[string]any{}
+	if err := json.Unmarshal([]byte(args), &value); err != nil {
+		validationErr.Issues = append(validationErr.Issues, ValidationIssue{
+			Path:    "$",
+			Message: fmt.Sprintf("arguments must be a JSON object: %v", err),
+		})
+		return validationErr
+	}
+
+	validationErr.Issues = validateValue(schema, value, "$")
+	if len(validationErr.Issues) > 0 {
+		return validationErr
+	}
+	return nil
+}
+
+// schemaMap returns the schema as a generic map, converting it through JSON if needed.
+func schemaMap(schema any) map[string]any {
+	switch s := schema.(type) {
+	case nil:
+		return nil
+	case map[string]any:
+		return s
+	}
+
+	schemaBytes, err := json.Marshal(schema)
+	if err != nil {
+		return nil
+	}
+	result := map[string]any{}
+	if err := json.Unmarshal(schemaBytes, &result); err != nil {
+		return nil
+	}
+	return result
+}
+
+func validateValue(schema map[string]any, value any, path string) []ValidationIssue {
+	issues := []ValidationIssue{}
+	issue := func(format string, args ...any) {
+		issues = append(issues, ValidationIssue{
+			Path:    path,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if types := schemaTypes(schema); len(types) > 0 && !slices.ContainsFunc(types, func(typ string) bool {
+		return matchesType(value, typ)
+	}) {
+		issue("must be of type %s, got %s", strings.Join(types, " or "), jsonType(value))
+		return issues
+	}
+
+	if enum, ok := schema["enum"]; ok {
+		values := anySlice(enum)
+		if !slices.ContainsFunc(values, func(v any) bool { return jsonEqual(v, value) }) {
+			enumBytes, _ := json.Marshal(values)
+			issue("must be one of %s", enumBytes)
+		}
+	}
+	if constValue, ok := schema["const"]; ok && !jsonEqual(constValue, value) {
+		constBytes, _ := json.Marshal(constValue)
+		issue("must be %s", constBytes)
+	}
+
+	switch val := value.(type) {
+	case string:
+		if minLength, ok := schemaNumber(schema, "minLength"); ok && float64(utf8.RuneCountInString(val)) < minLength {
+			if minLength == 1 {
+				issue("must not be empty")
+			} else {
+				issue("must be at least %v characters long", minLength)
+			}
+		}
+		if maxLength, ok := schemaNumber(schema, "maxLength"); ok && float64(utf8.RuneCountInString(val)) > maxLength {
+			issue("must be at most %v characters long", maxLength)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				issue("schema pattern %q is invalid: %v", pattern, err)
+			} else if !re.MatchString(val) {
+				issue("must match pattern %s", pattern)
+			}
+		}
+	case float64:
+		if minimum, ok := schemaNumber(schema, "minimum"); ok && val < minimum {
+			issue("must be >= %v", minimum)
+		}
+		if maximum, ok := schemaNumber(schema, "maximum"); ok && val > maximum {
+			issue("must be <= %v", maximum)
+		}
+	case []any:
+		if minItems, ok := schemaNumber(schema, "minItems"); ok && float64(len(val)) < minItems {
+			issue("must contain at least %v items", minItems)
+		}
+		if maxItems, ok := schemaNumber(schema, "maxItems"); ok && float64(len(val)) > maxItems {
+			issue("must contain at most %v items", maxItems)
+		}
+		if items := schemaMap(schema["items"]); items != nil {
+			for idx, item := range val {
+				issues = append(issues, validateValue(items, item, fmt.Sprintf("%s[%d]", path, idx))...)
+			}
+		}
+	case map[string]any:
+		props := schemaMap(schema["properties"])
+		for _, name := range requiredProperties(schema) {
+			if _, ok := val[name]; !ok {
+				issues = append(issues, ValidationIssue{
+					Path:    path + "." + name,
+					Message: "required property is missing",
+				})
+			}
+		}
+		names := []string{}
+		for name := range val {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			if propSchema := schemaMap(props[name]); propSchema != nil {
+				issues = append(issues, validateValue(propSchema, val[name], path+"."+name)...)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					known := []string{}
+					for prop := range props {
+						known = append(known, prop)
+					}
+					slices.Sort(known)
+					issues = append(issues, ValidationIssue{
+						Path:    path + "." + name,
+						Message: fmt.Sprintf("unknown property, expected one of: %s", strings.Join(known, ", ")),
+					})
+				}
+			case map[string]any:
+				issues = append(issues, validateValue(additional, val[name], path+"."+name)...)
+			}
+		}
+	}
+
+	return issues
+}
+
+func schemaTypes(schema map[string]any) []string {
+	switch typ := schema["type"].(type) {
+	case string:
+		return []string{typ}
+	case []string:
+		return typ
+	case []any:
+		types := []string{}
+		for _, t := range typ {
+			if s, ok := t.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func schemaNumber(schema map[string]any, key string) (float64, bool) {
+	switch n := schema[key].(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func requiredProperties(schema map[string]any) []string {
+	names := []string{}
+	for _, name := range anySlice(schema["required"]) {
+		if s, ok := name.(string); ok {
+			names = append(names, s)
+		}
+	}
+	return names
+}
+
+// anySlice converts the typed slices used in the Go written schemas into []any.
+func anySlice(v any) []any {
+	switch s := v.(type) {
+	case []any:
+		return s
+	case []string:
+		result := []any{}
+		for _, item := range s {
+			result = append(result, item)
+		}
+		return result
+	case nil:
+		return nil
+	}
+	sliceBytes, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	result := []any{}
+	if err := json.Unmarshal(sliceBytes, &result); err != nil {
+		return nil
+	}
+	return result
+}
+
+func jsonEqual(a, b any) bool {
+	aBytes, errA := json.Marshal(a)
+	bBytes, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(aBytes) == string(bBytes)
+}
+
+func jsonType(val any) string {
+	switch v := val.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case bool:
+		return "boolean"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", val)
+}
+
+func matchesType(val any, typ string) bool {
+	switch typ {
+	case "string":
+		_, ok := val.(string)
+		return ok
+	case "number":
+		_, ok := val.(float64)
+		return ok
+	case "integer":
+		f, ok := val.(float64)
+		return ok && f == math.Trunc(f)
+	case "boolean":
+		_, ok := val.(bool)
+		return ok
+	case "array":
+		_, ok := val.([]any)
+		return ok
+	case "object":
+		_, ok := val.(map[string]any)
+		return ok
+	case "null":
+		return val == nil
+	}
+	return true
+}
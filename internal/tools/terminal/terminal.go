@@ -0,0 +1,161 @@
+//go:build !windows
+
+package terminal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+)
+
+var ErrTimeout = errors.New("terminal expect timed out")
+
+// Terminal is the process running in the pseudo-terminal, its output is read in the background
+// and buffered until collected.
+type Terminal struct {
+	cmd *exec.Cmd
+	pty *os.File
+
+	mu     sync.Mutex
+	output []byte
+	// matched is the output offset after the last expected match
+	matched int
+	// changed is closed and replaced on the new output or the read end
+	changed chan struct{}
+	// readErr is the error ending the output, e.g. on the process exit
+	readErr error
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Start starts the command in the new pseudo-terminal.
+func Start(cmd *exec.Cmd) (*Terminal, error) {
+	ptyFile, err := pty.Start(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("start terminal: %w", err)
+	}
+	ptyFile, err = pollable(ptyFile)
+	if err != nil {
+		return nil, errors.Join(err, cmd.Process.Kill(), cmd.Wait())
+	}
+	t := &Terminal{
+		cmd:     cmd,
+		pty:     ptyFile,
+		changed: make(chan struct{}),
+	}
+	go t.read()
+	return t, nil
+}
+
+// pollable reopens the pty in the non-blocking mode, so its Close interrupts the pending read,
+// otherwise it is not closed until the processes keeping the terminal open, e.g. in the background, exit.
+func pollable(file *os.File) (*os.File, error) {
+	fd, err := syscall.Dup(int(file.Fd()))
+	closeErr := file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("dup terminal: %w", err)
+	}
+	if closeErr != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("close terminal: %w", closeErr)
+	}
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("set terminal non-blocking: %w", err)
+	}
+	return os.NewFile(uintptr(fd), file.Name()), nil
+}
+
+func (t *Terminal) read() {
+	chunk := make([]byte, 4096)
+	for {
+		n, err := t.pty.Read(chunk)
+
+		t.mu.Lock()
+		t.output = append(t.output, chunk[:n]...)
+		if err != nil {
+			t.readErr = err
+		}
+		close(t.changed)
+		t.changed = make(chan struct{})
+		t.mu.Unlock()
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Expect waits for the text in the output following the previous match, up to the timeout if it is positive,
+// or until the context is done. The read error is returned if the output ends without the text,
+// ErrTimeout if the timeout is reached.
+func (t *Terminal) Expect(ctx context.Context, text string, timeout time.Duration) error {
+	var timer <-chan time.Time
+	if timeout > 0 {
+		timeoutTimer := time.NewTimer(timeout)
+		defer timeoutTimer.Stop()
+		timer = timeoutTimer.C
+	}
+	for {
+		t.mu.Lock()
+		if idx := bytes.Index(t.output[t.matched:], []byte(text)); idx >= 0 {
+			t.matched += idx + len(text)
+			t.mu.Unlock()
+			return nil
+		}
+		readErr, changed := t.readErr, t.changed
+		t.mu.Unlock()
+
+		if readErr != nil {
+			return readErr
+		}
+		select {
+		case <-changed:
+		case <-timer:
+			return ErrTimeout
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Collect returns and drops the output read so far.
+func (t *Terminal) Collect() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	output := string(t.output)
+	t.output, t.matched = nil, 0
+	return output
+}
+
+func (t *Terminal) Send(text string) error {
+	_, err := t.pty.Write([]byte(text))
+	return err
+}
+
+// Close kills the process if it is still running and closes the pseudo-terminal.
+func (t *Terminal) Close() error {
+	t.closeOnce.Do(func() {
+		killErr := t.cmd.Process.Kill()
+		if errors.Is(killErr, os.ErrProcessDone) {
+			killErr = nil
+		}
+		t.closeErr = errors.Join(killErr, t.pty.Close())
+	})
+	return t.closeErr
+}
+
+// Wait waits for the process exit, it should be closed or exited.
+func (t *Terminal) Wait() error {
+	return t.cmd.Wait()
+}
@@ -2,10 +2,11 @@ package tools
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/tmc/langchaingo/llms"
@@ -21,14 +22,58 @@ yourself. Input can be any instruction or task.`,
 type ToolData struct {
 	Definition llms.FunctionDefinition
 	Call       func(context.Context, string) (string, error)
-	Cleanup    func() error
+	// Examples are the example calls shown in the tools prompt.
+	Examples []ToolExample
+
+	// Init, if set, prepares the tool before its first call, or on the executor setup with the eager init.
+	Init func(context.Context) error
+	// Health, if set, checks the tool is usable, e.g. its database is reachable.
+	Health func(context.Context) error
+	// Close releases the tool resources, Cleanup is used for the tools without it.
+	Close   func(context.Context) error
+	Cleanup func() error
+	// Reset, if set, resets the tool session state between the runs, e.g. on the ReWOO replan,
+	// keeping the other tool resources.
+	Reset func(context.Context) error
+
+	initMu      sync.Mutex
+	initialized bool
 }
 
 type ToolsExecutor struct {
 	Tools map[string]*ToolData
+
+	// Policies are the per-tool execution policies, DefaultPolicy is used for the tools without one.
+	Policies      map[string]ExecutionPolicy
+	DefaultPolicy ExecutionPolicy
+
+	// OutputLimits are the per-tool output size limits in bytes, DefaultOutputLimit is used for the tools without one.
+	// The outputs over the limit are truncated and can be paged through with the ReadMoreTool. Zero means no limit.
+	OutputLimits       map[string]int
+	DefaultOutputLimit int
+
+	// Audit, if set, records every call.
+	Audit *AuditLog
+
+	// CallPolicy, if set, is evaluated before every call, Approver decides on the calls requiring an approval.
+	CallPolicy *CallPolicy
+	Approver   Approver
+
+	// PromptDescMode is the ToolsPromptDesc parameters rendering mode.
+	PromptDescMode PromptDescMode
+
+	// Cache, if set, caches the results of the tools with the policy CacheTTL.
+	Cache *ToolCache
+
+	// Disabled are the tools removed from the executor by the health checks, with their errors.
+	Disabled map[string]error
+
+	breakersMu sync.Mutex
+	breakers   map[string]*circuitBreaker
+	outputs    outputStore
 }
 
-func (e ToolsExecutor) Execute(ctx context.Context, call llms.ToolCall) (llms.ToolCallResponse, error) {
+func (e *ToolsExecutor) Execute(ctx context.Context, call llms.ToolCall) (llms.ToolCallResponse, error) {
 	response := llms.ToolCallResponse{
 		ToolCallID: call.ID,
 		Name:       call.FunctionCall.Name,
@@ -46,7 +91,7 @@ func (e ToolsExecutor) Execute(ctx context.Context, call llms.ToolCall) (llms.To
 	return response, err
 }
 
-func (e ToolsExecutor) GetTool(toolName string) (*ToolData, error) {
+func (e *ToolsExecutor) GetTool(toolName string) (*ToolData, error) {
 	toolData, ok := e.Tools[toolName]
 	if !ok {
 		return nil, fmt.Errorf("no such tool")
@@ -54,16 +99,45 @@ func (e ToolsExecutor) GetTool(toolName string) (*ToolData, error) {
 	return toolData, nil
 }
 
-func (e ToolsExecutor) CallTool(ctx context.Context, toolName, args string) (string, error) {
+// CallTool checks the call policy, validates the arguments against the tool parameters schema,
+// calls the tool according to its execution policy and limits the output size.
+// The call is recorded by the audit log, if any, with the full output hash.
+func (e *ToolsExecutor) CallTool(ctx context.Context, toolName, args string) (string, error) {
+	start := time.Now()
+	content := ""
+	decision, err := e.authorize(ctx, toolName, args)
+	if err == nil {
+		content, err = e.callTool(ctx, toolName, args)
+	}
+	e.audit(ctx, toolName, args, decision, start, content, err)
+	if err != nil {
+		return "", err
+	}
+
+	return e.limitOutput(toolName, content), nil
+}
+
+func (e *ToolsExecutor) callTool(ctx context.Context, toolName, args string) (string, error) {
 	toolData, err := e.GetTool(toolName)
 	if err != nil {
 		return "", err
 	}
 
-	return toolData.Call(ctx, args)
+	if err := ValidateArguments(toolData.Definition, args); err != nil {
+		return "", err
+	}
+
+	return e.callCached(ctx, toolData, args)
+}
+
+func (e *ToolsExecutor) callInitialized(ctx context.Context, toolData *ToolData, args string) (string, error) {
+	if err := toolData.initialize(ctx); err != nil {
+		return "", err
+	}
+	return e.callWithPolicy(ctx, toolData, args)
 }
 
-func (e ToolsExecutor) ToolsList() []llms.Tool {
+func (e *ToolsExecutor) ToolsList() []llms.Tool {
 	tools := []llms.Tool{}
 	for _, toolData := range e.Tools {
 		tools = append(tools, llms.Tool{
@@ -80,41 +154,22 @@ func (e ToolsExecutor) ToolsList() []llms.Tool {
 	return tools
 }
 
-func (e ToolsExecutor) ToolsPromptDesc() string {
-	desc := ""
+// ToolCallError is a failed tool call with the arguments it was called with.
+type ToolCallError struct {
+	Tool      string
+	Arguments string
+	Err       error
+}
 
-	funcDefs := []llms.FunctionDefinition{
-		LLMDefinition,
-	}
-	for _, toolData := range e.Tools {
-		funcDefs = append(funcDefs, toolData.Definition)
-	}
-	slices.SortFunc(funcDefs,
-		func(a, b llms.FunctionDefinition) int {
-			return strings.Compare(a.Name, b.Name)
-		},
-	)
+func (e *ToolCallError) Error() string {
+	return fmt.Sprintf("calling tool %s with args: %s: %v", e.Tool, e.Arguments, e.Err)
+}
 
-	for idx, def := range funcDefs {
-		input := "string"
-		if def.Parameters != nil {
-			if props, ok := def.Parameters.(map[string]interface{})["properties"]; ok {
-				fields := map[string]string{}
-				for prop, val := range props.(map[string]interface{}) {
-					fields[prop] = val.(map[string]interface{})["type"].(string)
-				}
-				fieldsJson, err := json.Marshal(fields)
-				if err == nil {
-					input = string(fieldsJson)
-				}
-			}
-		}
-		desc += fmt.Sprintf("(%d) %s[%s]: %s\n", idx, def.Name, input, def.Description)
-	}
-	return desc
+func (e *ToolCallError) Unwrap() error {
+	return e.Err
 }
 
-func (e ToolsExecutor) ProcessToolCalls(ctx context.Context, calls []llms.ToolCall) string {
+func (e *ToolsExecutor) ProcessToolCalls(ctx context.Context, calls []llms.ToolCall) string {
 	content := ""
 	for _, toolCall := range calls {
 		response, err := e.Execute(ctx, toolCall)
@@ -134,14 +189,33 @@ func (e ToolsExecutor) ProcessToolCalls(ctx context.Context, calls []llms.ToolCa
 	return content
 }
 
-func (e ToolsExecutor) Cleanup() error {
-	for _, tool := range e.Tools {
-		if tool.Cleanup == nil {
+// ExecuteToolCalls executes the calls like ProcessToolCalls does, but returns
+// the last failed call as *ToolCallError instead of rendering it into the content.
+func (e *ToolsExecutor) ExecuteToolCalls(ctx context.Context, calls []llms.ToolCall) (string, error) {
+	content := ""
+	var callErr error
+	for _, toolCall := range calls {
+		response, err := e.Execute(ctx, toolCall)
+		if err != nil {
+			log.Warn().Err(err).Msgf(
+				"Tool %s call with args: %s",
+				toolCall.FunctionCall.Name,
+				toolCall.FunctionCall.Arguments,
+			)
+			callErr = &ToolCallError{
+				Tool:      toolCall.FunctionCall.Name,
+				Arguments: toolCall.FunctionCall.Arguments,
+				Err:       err,
+			}
 			continue
 		}
-		if err := tool.Cleanup(); err != nil {
-			return err
-		}
+		content = response.Content
+		callErr = nil
 	}
-	return nil
+	return content, callErr
+}
+
+// Cleanup closes every tool, see Close.
+func (e *ToolsExecutor) Cleanup() error {
+	return e.Close(context.Background())
 }
@@ -0,0 +1,275 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// NewTool builds the tool from the typed call function.
+// The definition parameters are derived from the Args struct (see ParametersSchema),
+// the call arguments are decoded into Args with the default values applied,
+// and the result is returned as is for string Result, or JSON encoded otherwise.
+func NewTool[Args, Result any](
+	name, description string,
+	call func(context.Context, Args) (Result, error),
+) *ToolData {
+	return &ToolData{
+		Definition: Definition[Args](name, description),
+		Call: func(ctx context.Context, input string) (string, error) {
+			args, err := DecodeArgs[Args](input)
+			if err != nil {
+				return "", err
+			}
+			result, err := call(ctx, args)
+			if err != nil {
+				return "", err
+			}
+			return EncodeResult(result)
+		},
+	}
+}
+
+// Definition returns the function definition with the parameters derived from the Args struct.
+func Definition[Args any](name, description string) llms.FunctionDefinition {
+	return llms.FunctionDefinition{
+		Name:        name,
+		Description: description,
+		Parameters:  ParametersSchema(reflect.TypeFor[Args]()),
+	}
+}
+
+// DecodeArgs decodes the JSON arguments into Args, applying the `default` tag values for the missing fields.
+// The non-object Args are decoded from the value property, as ParametersSchema wraps them.
+func DecodeArgs[Args any](input string) (Args, error) {
+	args := new(Args)
+	applyDefaults(reflect.ValueOf(args).Elem())
+	if strings.TrimSpace(input) == "" {
+		input = "{}"
+	}
+	var target any = args
+	if !isObjectType(reflect.TypeFor[Args]()) {
+		target = &struct {
+			Value *Args `json:"value"`
+		}{args}
+	}
+	if err := json.Unmarshal([]byte(input), target); err != nil {
+		return *args, fmt.Errorf("decode arguments: %w", err)
+	}
+	return *args, nil
+}
+
+// EncodeResult returns string and []byte results as is and JSON encodes the others.
+func EncodeResult(result any) (string, error) {
+	switch r := result.(type) {
+	case string:
+		return r, nil
+	case []byte:
+		return string(r), nil
+	}
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("encode result: %w", err)
+	}
+	return string(resultBytes), nil
+}
+
+// ParametersSchema derives the JSON schema of the struct type from its fields and tags:
+//
+//	json:"name"              the property name, "-" skips the field
+//	description:"..."        the property description
+//	required:"true"          adds the property to the required list
+//	enum:"a,b,c"             the allowed values, parsed according to the field type
+//	default:"value"          the default value, applied on decoding as well
+//	pattern:"^regex$"        the string pattern
+//	minLength, maxLength     the string length bounds
+//	minimum, maximum         the number bounds
+//
+// The non-object types are wrapped as the required value property, the recursive struct references
+// are left as plain objects.
+func ParametersSchema(t reflect.Type) map[string]any {
+	schema := typeSchema(t, map[reflect.Type]bool{})
+	if !isObjectType(t) {
+		return map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"value": schema,
+			},
+			"required": []string{"value"},
+		}
+	}
+	return schema
+}
+
+// isObjectType reports whether the type schema is the JSON object, passed as the parameters as is.
+func isObjectType(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct || t.Kind() == reflect.Map
+}
+
+// typeSchema returns the type JSON schema, visiting holds the structs being expanded.
+func typeSchema(t reflect.Type, visiting map[reflect.Type]bool) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{
+			"type":  "array",
+			"items": typeSchema(t.Elem(), visiting),
+		}
+	case reflect.Map:
+		return map[string]any{
+			"type":                 "object",
+			"additionalProperties": typeSchema(t.Elem(), visiting),
+		}
+	case reflect.Struct:
+		if visiting[t] {
+			return map[string]any{"type": "object"}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		properties := map[string]any{}
+		required := []string{}
+		addStructFields(t, properties, &required, visiting)
+		schema := map[string]any{
+			"type":       "object",
+			"properties": properties,
+		}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	}
+	return map[string]any{}
+}
+
+func addStructFields(t reflect.Type, properties map[string]any, required *[]string, visiting map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := fieldName(field)
+		if !ok {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct && !visiting[embedded] {
+				visiting[embedded] = true
+				addStructFields(embedded, properties, required, visiting)
+				delete(visiting, embedded)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		propSchema := typeSchema(field.Type, visiting)
+		if description := field.Tag.Get("description"); description != "" {
+			propSchema["description"] = description
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			values := []any{}
+			for _, v := range strings.Split(enum, ",") {
+				values = append(values, tagValue(field.Type, strings.TrimSpace(v)))
+			}
+			propSchema["enum"] = values
+		}
+		if def, ok := field.Tag.Lookup("default"); ok {
+			propSchema["default"] = tagValue(field.Type, def)
+		}
+		if pattern := field.Tag.Get("pattern"); pattern != "" {
+			propSchema["pattern"] = pattern
+		}
+		for _, key := range []string{"minLength", "maxLength", "minimum", "maximum"} {
+			if v := field.Tag.Get(key); v != "" {
+				if n, err := strconv.ParseFloat(v, 64); err == nil {
+					propSchema[key] = n
+				}
+			}
+		}
+
+		properties[name] = propSchema
+		if isRequired, _ := strconv.ParseBool(field.Tag.Get("required")); isRequired {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// fieldName returns the JSON property name of the field, empty for the untagged embedded structs.
+func fieldName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() && !field.Anonymous {
+		return "", false
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return "", false
+	}
+	if name == "" && !field.Anonymous {
+		return field.Name, true
+	}
+	return name, true
+}
+
+// tagValue parses the tag text as a JSON value of the field type, strings are taken as is.
+func tagValue(t reflect.Type, text string) any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.String {
+		return text
+	}
+	var value any
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return text
+	}
+	return value
+}
+
+func applyDefaults(v reflect.Value) {
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fieldVal := v.Field(i)
+		if !fieldVal.CanSet() {
+			continue
+		}
+		if field.Anonymous && fieldVal.Kind() == reflect.Struct {
+			applyDefaults(fieldVal)
+			continue
+		}
+		def, ok := field.Tag.Lookup("default")
+		if !ok {
+			continue
+		}
+		if field.Type.Kind() == reflect.String {
+			fieldVal.SetString(def)
+			continue
+		}
+		_ = json.Unmarshal([]byte(def), fieldVal.Addr().Interface())
+	}
+}
@@ -1,18 +1,33 @@
 package webreader
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"time"
 
 	htmltomarkdown "github.com/JohannesKaufmann/html-to-markdown/v2"
 	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
 )
 
-func ProcessUrl(u string) (string, error) {
-	resp, err := http.Get(u)
+// DefaultTimeout bounds the request if the context has no deadline.
+const DefaultTimeout = time.Minute
+
+var client = &http.Client{Timeout: DefaultTimeout}
+
+func ProcessUrl(ctx context.Context, u string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", fmt.Errorf("get %s: %s", u, resp.Status)
+	}
 
 	md, err := htmltomarkdown.ConvertReader(
 		resp.Body,
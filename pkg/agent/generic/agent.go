@@ -12,23 +12,48 @@ import (
 type Agent struct {
 	LLM           *openai.LLM
 	ToolsExecutor *tools.ToolsExecutor
+	// ToolSelector, if set, limits the tools sent with every call to the ones relevant to the last human message.
+	ToolSelector *tools.ToolSelector
 
 	toolsList *[]llms.Tool
 }
 
-func (a *Agent) Run(
-	ctx context.Context,
-	state []llms.MessageContent,
-	opts ...llms.CallOption,
-) (llms.MessageContent, error) {
+func (a *Agent) tools(ctx context.Context, query string) []llms.Tool {
+	if a.ToolSelector != nil {
+		return a.ToolSelector.SelectList(ctx, a.ToolsExecutor, query)
+	}
 	if a.toolsList == nil {
 		a.toolsList = &[]llms.Tool{}
 	}
 	if len(*a.toolsList) == 0 {
 		*a.toolsList = a.ToolsExecutor.ToolsList()
 	}
+	return *a.toolsList
+}
 
-	opts = append(opts, llms.WithTools(*a.toolsList))
+// lastHumanText is the text of the last human message in the state.
+func lastHumanText(state []llms.MessageContent) string {
+	for idx := len(state) - 1; idx >= 0; idx-- {
+		if state[idx].Role != llms.ChatMessageTypeHuman {
+			continue
+		}
+		text := ""
+		for _, part := range state[idx].Parts {
+			if textPart, ok := part.(llms.TextContent); ok {
+				text += textPart.Text + "\n"
+			}
+		}
+		return text
+	}
+	return ""
+}
+
+func (a *Agent) Run(
+	ctx context.Context,
+	state []llms.MessageContent,
+	opts ...llms.CallOption,
+) (llms.MessageContent, error) {
+	opts = append(opts, llms.WithTools(a.tools(ctx, lastHumanText(state))))
 
 	response, err := a.LLM.GenerateContent(
 		ctx, state, opts...,
@@ -52,14 +77,7 @@ func (a *Agent) SimpleRun(
 	input string,
 	opts ...llms.CallOption,
 ) (string, error) {
-	if a.toolsList == nil {
-		a.toolsList = &[]llms.Tool{}
-	}
-	if len(*a.toolsList) == 0 {
-		*a.toolsList = a.ToolsExecutor.ToolsList()
-	}
-
-	opts = append(opts, llms.WithTools(*a.toolsList))
+	opts = append(opts, llms.WithTools(a.tools(ctx, input)))
 
 	response, err := a.LLM.GenerateContent(ctx,
 		[]llms.MessageContent{
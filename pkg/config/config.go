@@ -20,8 +20,71 @@ type Config struct {
 	Model              string             `env:"MODEL"`
 	DefaultCallOptions DefaultCallOptions `env:"AI_DEFAULT_CALL_OPTION"`
 
+	// ToolOutputLimit is the default tool output size limit in bytes, the truncated outputs can be read with readMore tool.
+	ToolOutputLimit int `env:"TOOL_OUTPUT_LIMIT"`
+
+	// ToolDescVerbose renders the ReWOO planner tools parameters a line per parameter with the descriptions,
+	// instead of the compact signature.
+	ToolDescVerbose bool `env:"TOOL_DESC_VERBOSE"`
+
+	// ToolEagerInit initializes the tools on the executor creation instead of the first call,
+	// ToolHealthCheck checks their health too. The failing tools are disabled with a warning.
+	ToolEagerInit   bool `env:"TOOL_EAGER_INIT"`
+	ToolHealthCheck bool `env:"TOOL_HEALTH_CHECK"`
+
+	// Cache of the tools results with the policy CacheTTL (DDG search and webReader by default),
+	// either in-memory LRU of ToolCacheSize entries or on-disk in ToolCacheDir.
+	ToolCacheSize int    `env:"TOOL_CACHE_SIZE"`
+	ToolCacheDir  string `env:"TOOL_CACHE_DIR"`
+
+	// ToolPluginDir is the directory of the plugin executables providing the tools (see internal/tools/plugin),
+	// ToolPluginTimeout is the plugin call timeout in seconds, 30 by default.
+	ToolPluginDir     string `env:"TOOL_PLUGIN_DIR"`
+	ToolPluginTimeout int    `env:"TOOL_PLUGIN_TIMEOUT"`
+
+	// Audit log of every tool call, appended either to the JSONL file or to the Postgres table (tool_audit_log by default).
+	AuditLogFile         string `env:"AUDIT_LOG_FILE"`
+	AuditLogDBConnection string `env:"AUDIT_LOG_DB_CONNECTION"`
+	AuditLogDBTable      string `env:"AUDIT_LOG_DB_TABLE"`
+
+	// ToolPolicyFile is the YAML or JSON call policy evaluated before every tool call,
+	// ToolPolicyDryRun only logs the violations.
+	ToolPolicyFile   string `env:"TOOL_POLICY_FILE"`
+	ToolPolicyDryRun bool   `env:"TOOL_POLICY_DRY_RUN"`
+
+	// ToolSelectionTopK limits the tools exposed to the agent and ReWOO planner to the most relevant ones
+	// plus the always on ones, zero disables the selection. Tools are ranked by the keyword index,
+	// or by the embeddings if the embedding model is set.
+	ToolSelectionTopK           int      `env:"TOOL_SELECTION_TOP_K"`
+	ToolSelectionAlwaysOn       []string `env:"TOOL_SELECTION_ALWAYS_ON"`
+	ToolSelectionAIURL          string   `env:"AI_URL,TOOL_SELECTION_AI_URL"`
+	ToolSelectionAIToken        string   `env:"AI_TOKEN,TOOL_SELECTION_AI_TOKEN"`
+	ToolSelectionEmbeddingModel string   `env:"TOOL_SELECTION_EMBEDDING_MODEL"`
+
 	ReWOODisable            bool               `env:"REWOO_DISABLE"`
 	RewOODefaultCallOptions DefaultCallOptions `env:"REWOO_DEFAULT_CALL_OPTION"`
+	ReWOORetryAction        string             `env:"REWOO_RETRY_ACTION"`
+	ReWOORetryMax           int                `env:"REWOO_RETRY_MAX"`
+	ReWOOEvidenceMaxSize    int                `env:"REWOO_EVIDENCE_MAX_SIZE"`
+	ReWOOEvidenceMode       string             `env:"REWOO_EVIDENCE_MODE"`
+	ReWOOEvidenceChunkSize  int                `env:"REWOO_EVIDENCE_CHUNK_SIZE"`
+	ReWOOAllowNested        bool               `env:"REWOO_ALLOW_NESTED"`
+	ReWOOMaxDepth           int                `env:"REWOO_MAX_DEPTH"`
+
+	// ReWOO per-role models, the empty values fall back to the AI_URL, AI_TOKEN and MODEL ones,
+	// the unset call options fall back to the REWOO_DEFAULT_CALL_OPTION ones except for the MODEL with the role model set.
+	ReWOOPlannerAIURL              string             `env:"REWOO_PLANNER_AI_URL"`
+	ReWOOPlannerAIToken            string             `env:"REWOO_PLANNER_AI_TOKEN"`
+	ReWOOPlannerModel              string             `env:"REWOO_PLANNER_MODEL"`
+	ReWOOPlannerDefaultCallOptions DefaultCallOptions `env:"REWOO_PLANNER_DEFAULT_CALL_OPTION"`
+	ReWOOWorkerAIURL               string             `env:"REWOO_WORKER_AI_URL"`
+	ReWOOWorkerAIToken             string             `env:"REWOO_WORKER_AI_TOKEN"`
+	ReWOOWorkerModel               string             `env:"REWOO_WORKER_MODEL"`
+	ReWOOWorkerDefaultCallOptions  DefaultCallOptions `env:"REWOO_WORKER_DEFAULT_CALL_OPTION"`
+	ReWOOSolverAIURL               string             `env:"REWOO_SOLVER_AI_URL"`
+	ReWOOSolverAIToken             string             `env:"REWOO_SOLVER_AI_TOKEN"`
+	ReWOOSolverModel               string             `env:"REWOO_SOLVER_MODEL"`
+	ReWOOSolverDefaultCallOptions  DefaultCallOptions `env:"REWOO_SOLVER_DEFAULT_CALL_OPTION"`
 
 	SemanticSearchDisable        bool   `env:"SEMANTIC_SEARCH_DISABLE"`
 	SemanticSearchAIURL          string `env:"AI_URL,SEMANTIC_SEARCH_AI_URL"`
@@ -40,6 +103,34 @@ type Config struct {
 
 	CommandExecutorDisable  bool              `env:"COMMAND_EXECUTOR_DISABLE"`
 	CommandExecutorCommands map[string]string `env:"COMMAND_EXECUTOR_CMD_*"`
+	// CommandExecutorTimeout is the default command timeout in seconds, 30 by default,
+	// CommandExecutorMaxTimeout caps the timeouts set by the model and the background jobs wait.
+	CommandExecutorTimeout    int `env:"COMMAND_EXECUTOR_TIMEOUT"`
+	CommandExecutorMaxTimeout int `env:"COMMAND_EXECUTOR_MAX_TIMEOUT"`
+	// CommandExecutorMaxOutput is the command stdout and stderr size limit in bytes, 1MiB by default.
+	CommandExecutorMaxOutput int `env:"COMMAND_EXECUTOR_MAX_OUTPUT"`
+
+	// CPU time in seconds, memory and file size in MiB, the CPU quota in CPUs
+	CommandExecutorSandbox          bool    `env:"COMMAND_EXECUTOR_SANDBOX"`
+	CommandExecutorSandboxNetwork   bool    `env:"COMMAND_EXECUTOR_SANDBOX_NETWORK"`
+	CommandExecutorSandboxCPUTime   int     `env:"COMMAND_EXECUTOR_SANDBOX_CPU_TIME"`
+	CommandExecutorSandboxMemory    int     `env:"COMMAND_EXECUTOR_SANDBOX_MEMORY"`
+	CommandExecutorSandboxProcesses int     `env:"COMMAND_EXECUTOR_SANDBOX_PROCESSES"`
+	CommandExecutorSandboxFileSize  int     `env:"COMMAND_EXECUTOR_SANDBOX_FILE_SIZE"`
+	CommandExecutorSandboxCgroup    string  `env:"COMMAND_EXECUTOR_SANDBOX_CGROUP"`
+	CommandExecutorSandboxCPUQuota  float64 `env:"COMMAND_EXECUTOR_SANDBOX_CPU_QUOTA"`
+
+	// MCPServers are the MCP servers by name, the value is either a stdio server command line (quoted as in shell)
+	// or a streamable HTTP server URL. The server tools are named as <name>__<tool>.
+	MCPServers map[string]string `env:"MCP_SERVER_*"`
+
+	// OpenAPISpecs are the OpenAPI 3 documents by name, a file path or URL, a tool per operation is named
+	// as <name>__<operationId>. The base URL overrides the document server, the auth header is "Name: value",
+	// the operations is a comma separated operation IDs allowlist.
+	OpenAPISpecs       map[string]string `env:"OPENAPI_SPEC_*"`
+	OpenAPIBaseURLs    map[string]string `env:"OPENAPI_BASE_URL_*"`
+	OpenAPIAuthHeaders map[string]string `env:"OPENAPI_AUTH_HEADER_*"`
+	OpenAPIOperations  map[string]string `env:"OPENAPI_OPERATIONS_*"`
 }
 
 // See tmc/langchaingo/llms/options.go
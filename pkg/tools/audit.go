@@ -0,0 +1,120 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Swarmind/libagent/internal/tools"
+	"github.com/Swarmind/libagent/pkg/config"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AuditLog = tools.AuditLog
+type AuditRecord = tools.AuditRecord
+type AuditSink = tools.AuditSink
+type JSONLAuditSink = tools.JSONLAuditSink
+type PostgresAuditSink = tools.PostgresAuditSink
+
+const (
+	AuditDecisionAllowed  = tools.AuditDecisionAllowed
+	AuditDecisionApproved = tools.AuditDecisionApproved
+	AuditDecisionDenied   = tools.AuditDecisionDenied
+)
+
+// NewAuditLog returns the audit log appending to the sink with a random session ID.
+func NewAuditLog(sink AuditSink) *AuditLog {
+	return tools.NewAuditLog(sink)
+}
+
+// WithRunID sets the run ID recorded in the audit records of the calls made with the context.
+// ReWOO sets its top level run ID if there is none.
+func WithRunID(ctx context.Context, runID string) context.Context {
+	return tools.ContextWithRunID(ctx, runID)
+}
+
+// VerifyAuditRecords checks the records hashes and chain links.
+func VerifyAuditRecords(records []AuditRecord) error {
+	return tools.VerifyAuditRecords(records)
+}
+
+// VerifyAuditFile checks the JSONL audit file chain integrity.
+func VerifyAuditFile(path string) error {
+	records, err := tools.ReadJSONLAudit(path)
+	if err != nil {
+		return err
+	}
+	return tools.VerifyAuditRecords(records)
+}
+
+// configAuditSink is the audit log created from the config, with its sink close function.
+type configAuditSink struct {
+	auditLog *AuditLog
+	close    func() error
+}
+
+var (
+	configAuditLogsMu sync.Mutex
+	// configAuditLogs are shared by the executors, so every sink has a single chain writer
+	configAuditLogs = map[string]configAuditSink{}
+)
+
+// CloseConfigAuditLogs closes the file and DB pool of the audit logs created from the config,
+// once the executors using them are closed. The next created executor opens them again.
+func CloseConfigAuditLogs() error {
+	configAuditLogsMu.Lock()
+	defer configAuditLogsMu.Unlock()
+
+	errs := []error{}
+	for key, configSink := range configAuditLogs {
+		if err := configSink.close(); err != nil {
+			errs = append(errs, fmt.Errorf("audit log close: %w", err))
+		}
+		delete(configAuditLogs, key)
+	}
+	return errors.Join(errs...)
+}
+
+func configAuditLog(ctx context.Context, cfg config.Config) (*AuditLog, error) {
+	if cfg.AuditLogFile != "" && cfg.AuditLogDBConnection != "" {
+		return nil, fmt.Errorf("audit log: set either the file or the DB connection")
+	}
+	key := ""
+	switch {
+	case cfg.AuditLogFile != "":
+		key = "file:" + cfg.AuditLogFile
+	case cfg.AuditLogDBConnection != "":
+		key = "db:" + cfg.AuditLogDBConnection + ":" + cfg.AuditLogDBTable
+	default:
+		return nil, nil
+	}
+
+	configAuditLogsMu.Lock()
+	defer configAuditLogsMu.Unlock()
+
+	if configSink, ok := configAuditLogs[key]; ok {
+		return configSink.auditLog, nil
+	}
+
+	configSink := configAuditSink{}
+	if cfg.AuditLogFile != "" {
+		sink := &JSONLAuditSink{Path: cfg.AuditLogFile}
+		configSink.auditLog, configSink.close = NewAuditLog(sink), sink.Close
+	} else {
+		pool, err := pgxpool.New(ctx, cfg.AuditLogDBConnection)
+		if err != nil {
+			return nil, fmt.Errorf("audit log db: %w", err)
+		}
+		sink := &PostgresAuditSink{Pool: pool, Table: cfg.AuditLogDBTable}
+		configSink.auditLog = NewAuditLog(sink)
+		configSink.close = func() error {
+			pool.Close()
+			return nil
+		}
+	}
+
+	configAuditLogs[key] = configSink
+	return configSink.auditLog, nil
+}
@@ -0,0 +1,76 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Swarmind/libagent/internal/tools"
+	"github.com/Swarmind/libagent/pkg/config"
+)
+
+type ToolCache = tools.ToolCache
+type CacheBackend = tools.CacheBackend
+type CacheStats = tools.CacheStats
+type MemoryCache = tools.MemoryCache
+type DiskCache = tools.DiskCache
+
+// NewToolCache returns the cache of the results of the tools with the policy CacheTTL.
+func NewToolCache(backend CacheBackend) *ToolCache {
+	return tools.NewToolCache(backend)
+}
+
+// NewMemoryCache returns the in-memory LRU cache of at most maxEntries results.
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return tools.NewMemoryCache(maxEntries)
+}
+
+// WithoutCache bypasses the cached results for the calls made with the context, refreshing them.
+func WithoutCache(ctx context.Context) context.Context {
+	return tools.ContextWithoutCache(ctx)
+}
+
+var (
+	configCachesMu sync.Mutex
+	// configCaches are shared by the executors, so the nested and repeated runs reuse the results
+	configCaches = map[string]*ToolCache{}
+)
+
+func configToolCache(cfg config.Config) (*ToolCache, error) {
+	if cfg.ToolCacheDir != "" && cfg.ToolCacheSize > 0 {
+		return nil, fmt.Errorf("tool cache: set either the dir or the size")
+	}
+	key := ""
+	switch {
+	case cfg.ToolCacheDir != "":
+		key = "dir:" + cfg.ToolCacheDir
+	case cfg.ToolCacheSize > 0:
+		key = fmt.Sprintf("memory:%d", cfg.ToolCacheSize)
+	default:
+		return nil, nil
+	}
+
+	configCachesMu.Lock()
+	defer configCachesMu.Unlock()
+
+	if cache, ok := configCaches[key]; ok {
+		return cache, nil
+	}
+
+	var backend CacheBackend
+	if cfg.ToolCacheDir != "" {
+		backend = DiskCache{Dir: cfg.ToolCacheDir}
+	} else {
+		backend = NewMemoryCache(cfg.ToolCacheSize)
+	}
+	cache := NewToolCache(backend)
+	configCaches[key] = cache
+	return cache, nil
+}
+
+// WithToolCache sets the cache of the results of the tools with the policy CacheTTL.
+func WithToolCache(cache *ToolCache) ExecutorOption {
+	return func(eo *ExecutorOptions) {
+		eo.Cache = cache
+	}
+}
@@ -0,0 +1,85 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/Swarmind/libagent/internal/tools"
+)
+
+type CallPolicy = tools.CallPolicy
+type CallRule = tools.CallRule
+type CallCondition = tools.CallCondition
+type CallAction = tools.CallAction
+type Approver = tools.Approver
+type ApprovalRequest = tools.ApprovalRequest
+
+const (
+	CallAllow   = tools.CallAllow
+	CallDeny    = tools.CallDeny
+	CallApprove = tools.CallApprove
+)
+
+var ErrCallDenied = tools.ErrCallDenied
+
+// LoadCallPolicy reads the YAML or JSON call policy file, e.g.:
+//
+//	default: allow
+//	rules:
+//	  - name: no-recursive-removal
+//	    tools: [commandExecutor, commandJobStart]
+//	    conditions: [{argument: command, regex: 'rm\s+-\w*r'}]
+//	    action: deny
+//	  - name: lab-only-scans
+//	    tools: [nmap]
+//	    conditions: [{argument: ip, cidrs: [10.10.0.0/16], negate: true}]
+//	    action: deny
+//	    message: only the lab network can be scanned
+func LoadCallPolicy(path string) (*CallPolicy, error) {
+	return tools.LoadCallPolicy(path)
+}
+
+// WithCallPolicy sets the policy evaluated before every call. The executor compiles its copy,
+// failing on the invalid policy.
+func WithCallPolicy(policy *CallPolicy) ExecutorOption {
+	return func(eo *ExecutorOptions) {
+		eo.CallPolicy = policy
+	}
+}
+
+// WithApprover sets the approver deciding on the calls requiring an approval, which are denied without one.
+func WithApprover(approver Approver) ExecutorOption {
+	return func(eo *ExecutorOptions) {
+		eo.Approver = approver
+	}
+}
+
+// NewConsoleApprover asks to approve the calls on the out writer, reading y/n answers from the in reader.
+func NewConsoleApprover(in io.Reader, out io.Writer) Approver {
+	mu := sync.Mutex{}
+	reader := bufio.NewReader(in)
+	return func(ctx context.Context, request ApprovalRequest) (bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		prompt := fmt.Sprintf("Tool %s call with args: %s\nrequires an approval by the rule %s",
+			request.Tool, request.Arguments, request.Rule,
+		)
+		if request.Message != "" {
+			prompt += ": " + request.Message
+		}
+		if _, err := fmt.Fprintf(out, "%s\nApprove? [y/N]: ", prompt); err != nil {
+			return false, err
+		}
+		answer, err := reader.ReadString('\n')
+		if err != nil && answer == "" {
+			return false, err
+		}
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes", nil
+	}
+}
@@ -0,0 +1,296 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Swarmind/libagent/internal/tools"
+	"github.com/rs/zerolog/log"
+)
+
+// commandJobOutputLimit is the unread job output kept, the older output is dropped.
+const commandJobOutputLimit = 1 << 20
+
+type CommandJobStartArgs struct {
+	Command string `json:"command" description:"the shell command to run in the background" required:"true" minLength:"1"`
+}
+
+type CommandJobArgs struct {
+	ID int `json:"id" description:"the job ID returned by commandJobStart" required:"true"`
+}
+
+type CommandJobOutputArgs struct {
+	ID   int `json:"id" description:"the job ID returned by commandJobStart" required:"true"`
+	Wait int `json:"wait,omitempty" description:"seconds to wait for the job to finish, the output is returned right away if not set" minimum:"0"`
+}
+
+type CommandJobListArgs struct{}
+
+// The commandJobStart command runs the same shell commands as the commandExecutor,
+// so the call policy rules matching the commandExecutor commands should list it too.
+var (
+	CommandJobStartDefinition = tools.Definition[CommandJobStartArgs](
+		"commandJobStart",
+		`Starts a long running shell command (builds, downloads, scans) in the background in the commandExecutor working directory,
+without its shell variables and current directory. Returns the job ID to get the output of or to kill the job.`,
+	)
+	CommandJobOutputDefinition = tools.Definition[CommandJobOutputArgs](
+		"commandJobOutput",
+		`Returns the background job status and its output since the previous commandJobOutput call,
+optionally waiting for the job to finish.`,
+	)
+	CommandJobKillDefinition = tools.Definition[CommandJobArgs](
+		"commandJobKill",
+		"Kills the background job with its child processes and returns its status and the remaining output.",
+	)
+	CommandJobListDefinition = tools.Definition[CommandJobListArgs](
+		"commandJobList",
+		"Lists the background jobs with their commands and statuses.",
+	)
+)
+
+// CommandJobStatus is the result of the background jobs tools.
+type CommandJobStatus struct {
+	ID       int    `json:"id"`
+	Command  string `json:"command"`
+	Running  bool   `json:"running"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Output   string `json:"output,omitempty"`
+	// DroppedBytes of the output not read before the unread output limit was reached.
+	DroppedBytes int `json:"dropped_bytes,omitempty"`
+}
+
+// commandJob is the background command, its output is buffered until read.
+type commandJob struct {
+	id      int
+	command string
+	cmd     *exec.Cmd
+	// done is closed when the command exits, err is its wait result
+	done chan struct{}
+	err  error
+
+	mu      sync.Mutex
+	output  []byte
+	dropped int
+}
+
+func (j *commandJob) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.output = append(j.output, p...)
+	if over := len(j.output) - commandJobOutputLimit; over > 0 {
+		j.output = append(j.output[:0], j.output[over:]...)
+		j.dropped += over
+	}
+	return len(p), nil
+}
+
+func (j *commandJob) running() bool {
+	select {
+	case <-j.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// status returns the job status, with the unread output if read is set.
+func (j *commandJob) status(read bool) CommandJobStatus {
+	status := CommandJobStatus{ID: j.id, Command: j.command, Running: j.running()}
+	if !status.Running {
+		exitErr := &exec.ExitError{}
+		switch {
+		case j.err == nil:
+			status.ExitCode = new(int)
+		case errors.As(j.err, &exitErr) && exitErr.ExitCode() >= 0:
+			exitCode := exitErr.ExitCode()
+			status.ExitCode = &exitCode
+		default:
+			status.Error = j.err.Error()
+		}
+	}
+	if read {
+		j.mu.Lock()
+		status.Output, status.DroppedBytes = string(j.output), j.dropped
+		j.output, j.dropped = nil, 0
+		j.mu.Unlock()
+	}
+	return status
+}
+
+func (j *commandJob) kill() {
+	if !j.running() {
+		return
+	}
+	// The job outside of the sandbox leads its process group, the sandboxed one is its PID namespace init
+	if j.cmd.SysProcAttr != nil && j.cmd.SysProcAttr.Setpgid {
+		if err := syscall.Kill(-j.cmd.Process.Pid, syscall.SIGKILL); err != nil {
+			log.Debug().Err(err).Msgf("command job %d kill", j.id)
+		}
+		return
+	}
+	if err := j.cmd.Process.Kill(); err != nil {
+		log.Debug().Err(err).Msgf("command job %d kill", j.id)
+	}
+}
+
+func (s *CommandExecutorTool) jobTools() []*ToolData {
+	return []*ToolData{
+		tools.NewTool(CommandJobStartDefinition.Name, CommandJobStartDefinition.Description, s.StartJob),
+		tools.NewTool(CommandJobOutputDefinition.Name, CommandJobOutputDefinition.Description, s.JobOutput),
+		tools.NewTool(CommandJobKillDefinition.Name, CommandJobKillDefinition.Description, s.KillJob),
+		tools.NewTool(CommandJobListDefinition.Name, CommandJobListDefinition.Description,
+			func(ctx context.Context, args CommandJobListArgs) ([]CommandJobStatus, error) {
+				return s.Jobs(), nil
+			},
+		),
+	}
+}
+
+// StartJob runs the command in the background in the session directory, or in the session sandbox.
+func (s *CommandExecutorTool) StartJob(ctx context.Context, args CommandJobStartArgs) (CommandJobStatus, error) {
+	// The session lock is held until the job is registered, so the session close does not miss it
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cmd, err := s.jobCommand(args.Command)
+	if err != nil {
+		return CommandJobStatus{}, err
+	}
+
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+
+	s.lastJobID++
+	job := &commandJob{
+		id:      s.lastJobID,
+		command: args.Command,
+		cmd:     cmd,
+		done:    make(chan struct{}),
+	}
+	cmd.Stdout, cmd.Stderr = job, job
+	// The output copying is not waited for long after the exit, if the job left the processes holding it
+	cmd.WaitDelay = 5 * time.Second
+	if err := cmd.Start(); err != nil {
+		return CommandJobStatus{}, fmt.Errorf("start job: %w", err)
+	}
+	log.Debug().Msgf("command job %d started: %s", job.id, job.command)
+	go func() {
+		job.err = cmd.Wait()
+		close(job.done)
+		log.Debug().Err(job.err).Msgf("command job %d finished", job.id)
+	}()
+
+	if s.jobs == nil {
+		s.jobs = map[int]*commandJob{}
+	}
+	s.jobs[job.id] = job
+	return job.status(false), nil
+}
+
+// jobCommand builds the job command in the session started if needed, s.mu is held by the caller.
+func (s *CommandExecutorTool) jobCommand(command string) (*exec.Cmd, error) {
+	if err := s.start(); err != nil {
+		return nil, err
+	}
+	if s.sandbox != nil {
+		return s.sandbox.Command("bash", "--norc", "--noprofile", "-c", command)
+	}
+
+	cmd := exec.Command("bash", "--norc", "--noprofile", "-c", command)
+	cmd.Dir = *s.tempDir
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH"), "HOME=" + *s.tempDir}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return cmd, nil
+}
+
+func (s *CommandExecutorTool) job(id int) (*commandJob, error) {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("no job with ID %d", id)
+	}
+	return job, nil
+}
+
+// JobOutput returns the job status with the output since the previous call,
+// waiting for the job to finish up to the args Wait seconds (capped by the MaxTimeout).
+func (s *CommandExecutorTool) JobOutput(ctx context.Context, args CommandJobOutputArgs) (CommandJobStatus, error) {
+	job, err := s.job(args.ID)
+	if err != nil {
+		return CommandJobStatus{}, err
+	}
+
+	if args.Wait > 0 {
+		wait := time.Duration(args.Wait) * time.Second
+		if s.MaxTimeout > 0 {
+			wait = min(wait, s.MaxTimeout)
+		}
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-job.done:
+		case <-timer.C:
+		case <-ctx.Done():
+			return CommandJobStatus{}, ctx.Err()
+		}
+	}
+	return job.status(true), nil
+}
+
+// KillJob kills the job and returns its status with the remaining output.
+func (s *CommandExecutorTool) KillJob(ctx context.Context, args CommandJobArgs) (CommandJobStatus, error) {
+	job, err := s.job(args.ID)
+	if err != nil {
+		return CommandJobStatus{}, err
+	}
+
+	job.kill()
+	select {
+	case <-job.done:
+	case <-ctx.Done():
+		return CommandJobStatus{}, ctx.Err()
+	}
+	return job.status(true), nil
+}
+
+// Jobs returns the jobs statuses without their output, ordered by ID.
+func (s *CommandExecutorTool) Jobs() []CommandJobStatus {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+
+	statuses := []CommandJobStatus{}
+	for _, job := range s.jobs {
+		statuses = append(statuses, job.status(false))
+	}
+	slices.SortFunc(statuses, func(a, b CommandJobStatus) int {
+		return a.ID - b.ID
+	})
+	return statuses
+}
+
+// killJobs kills the jobs and waits for them to exit.
+func (s *CommandExecutorTool) killJobs() {
+	s.jobsMu.Lock()
+	jobs := s.jobs
+	s.jobs = nil
+	s.jobsMu.Unlock()
+
+	for _, job := range jobs {
+		job.kill()
+	}
+	for _, job := range jobs {
+		<-job.done
+	}
+}
@@ -0,0 +1,78 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultCommandMaxOutput is the stdout and stderr size limit if the tool MaxOutput is not set.
+const DefaultCommandMaxOutput = 1 << 20
+
+// CommandResult is the command execution result, rendered for the model with String.
+type CommandResult struct {
+	Command string `json:"command"`
+	Stdout  string `json:"stdout"`
+	// Stderr is empty if it was not separable, e.g. the command was written to the terminal.
+	Stderr string `json:"stderr"`
+	// ExitCode is -1 if the shell did not return to the prompt.
+	ExitCode int           `json:"exit_code"`
+	Duration time.Duration `json:"duration"`
+	TimedOut bool          `json:"timed_out"`
+	// Truncated is set if the head of stdout or stderr was cut off over the MaxOutput.
+	Truncated bool `json:"truncated"`
+	// Dir is the shell working directory after the command.
+	Dir string `json:"dir"`
+	// Restarted is set if the shell was killed as the command ignored the interrupt,
+	// the next command starts in the new session.
+	Restarted bool `json:"restarted"`
+}
+
+// String renders the result compactly: the status line with the exit code, duration, working directory
+// and the flags, then stdout and stderr following the [stderr] line if any.
+func (r CommandResult) String() string {
+	status := []string{
+		fmt.Sprintf("exit %d", r.ExitCode),
+		r.Duration.Round(10 * time.Millisecond).String(),
+	}
+	if r.Dir != "" {
+		status = append(status, "cwd "+r.Dir)
+	}
+	if r.TimedOut {
+		status = append(status, "timed out")
+	}
+	if r.Truncated {
+		status = append(status, "truncated")
+	}
+	if r.Restarted {
+		status = append(status, "shell restarted")
+	}
+
+	result := "[" + strings.Join(status, ", ") + "]"
+	if r.Stdout != "" {
+		result += "\n" + r.Stdout
+	}
+	if r.Stderr != "" {
+		result += "\n[stderr]\n" + r.Stderr
+	}
+	return result
+}
+
+// commandOutput normalizes the terminal line endings and trims the output blank lines.
+func commandOutput(output string) string {
+	output = strings.ReplaceAll(output, "\r\n", "\n")
+	return strings.TrimRight(strings.TrimLeft(output, "\r\n"), " \r\n")
+}
+
+// outputTail keeps the last limit bytes of the output, reporting whether it was cut.
+func outputTail(output string, limit int) (string, bool) {
+	if limit <= 0 || len(output) <= limit {
+		return output, false
+	}
+	start := len(output) - limit
+	for start < len(output) && !utf8.RuneStart(output[start]) {
+		start++
+	}
+	return output[start:], true
+}
@@ -2,49 +2,34 @@ package tools
 
 import (
 	"context"
-	"encoding/json"
 
 	"github.com/Swarmind/libagent/internal/tools"
 	"github.com/Swarmind/libagent/pkg/config"
 
-	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/tools/duckduckgo"
 )
 
-var DDGSearchDefinition = llms.FunctionDefinition{
-	Name: "webSearch",
-	Description: `A duckduckgo search wrapper.
-Given search query returns a multiple results with short descriptions and URLs.`,
-	Parameters: map[string]any{
-		"type": "object",
-		"properties": map[string]any{
-			"query": map[string]any{
-				"type":        "string",
-				"description": "The duckduckgo search query",
-			},
-		},
-	},
-}
-
 type DDGSearchArgs struct {
-	Query string `json:"query"`
+	Query string `json:"query" description:"The duckduckgo search query" required:"true" minLength:"1"`
 }
 
+var DDGSearchDefinition = tools.Definition[DDGSearchArgs](
+	"webSearch",
+	`A duckduckgo search wrapper.
+Given search query returns a multiple results with short descriptions and URLs.`,
+)
+
 type DDGSearchTool struct {
 	wrappedTool *duckduckgo.Tool
 }
 
-func (t DDGSearchTool) Call(ctx context.Context, input string) (string, error) {
-	ddgSearchArgs := DDGSearchArgs{}
-	if err := json.Unmarshal([]byte(input), &ddgSearchArgs); err != nil {
-		return "", err
-	}
-	return t.wrappedTool.Call(ctx, ddgSearchArgs.Query)
+func (t DDGSearchTool) Call(ctx context.Context, args DDGSearchArgs) (string, error) {
+	return t.wrappedTool.Call(ctx, args.Query)
 }
 
 func init() {
-	globalToolsRegistry = append(globalToolsRegistry,
-		func(ctx context.Context, cfg config.Config) (*tools.ToolData, error) {
+	MustRegister(DDGSearchDefinition.Name,
+		func(ctx context.Context, cfg config.Config, executor *ToolsExecutor) (*ToolData, error) {
 			if cfg.DDGSearchDisable {
 				return nil, nil
 			}
@@ -67,10 +52,13 @@ func init() {
 				wrappedTool: wrappedTool,
 			}
 
-			return &tools.ToolData{
-				Definition: DDGSearchDefinition,
-				Call:       ddgSearchTool.Call,
-			}, nil
+			tool := tools.NewTool(
+				DDGSearchDefinition.Name,
+				DDGSearchDefinition.Description,
+				ddgSearchTool.Call,
+			)
+			tool.Examples = []tools.ToolExample{{Arguments: `{"query": "golang generics tutorial"}`}}
+			return tool, nil
 		},
 	)
 }
@@ -2,98 +2,110 @@ package tools
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Swarmind/libagent/internal/tools"
+	"github.com/Swarmind/libagent/internal/tools/sandbox"
+	"github.com/Swarmind/libagent/internal/tools/terminal"
 	"github.com/Swarmind/libagent/pkg/config"
-	"github.com/ThomasRooney/gexpect"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
-
 	"github.com/tmc/langchaingo/llms"
 )
 
 const CommandNotesPromptAddition = `Important! List of host machine specific command usage recommendations:`
 
-var CommandExecutorDefinition = llms.FunctionDefinition{
-	Name: "commandExecutor",
-	Description: `Executes a provided command in a interactive stateful bash shell session.
-Most likely all needed packages are preinstalled.`,
-	Parameters: map[string]any{
-		"type": "object",
-		"properties": map[string]any{
-			"command": map[string]any{
-				"type":        "string",
-				"description": "the shell command to execute to",
-			},
-		},
-	},
-}
-
 type CommandExecutorArgs struct {
-	Command string `json:"command"`
+	Command string `json:"command" description:"the shell command to execute to" required:"true" minLength:"1"`
+	Timeout int    `json:"timeout,omitempty" description:"the command timeout in seconds, the default one if not set" minimum:"0"`
 }
 
+var CommandExecutorDefinition = tools.Definition[CommandExecutorArgs](
+	"commandExecutor",
+	`Executes a provided command in a interactive stateful bash shell session.
+Most likely all needed packages are preinstalled.
+The command is interrupted after the timeout, run the long commands as the background jobs with commandJobStart.
+The result starts with the [exit code, duration, working directory] line, followed by stdout, and stderr after [stderr].`,
+)
+
+// DefaultCommandTimeout is the command timeout if neither the call nor the tool sets it.
+const DefaultCommandTimeout = 30 * time.Second
+
+// commandInterruptWait is how long the interrupted command is waited for to return to the prompt.
+const commandInterruptWait = 5 * time.Second
+
+// shellColumns is the terminal width for the shell readline, otherwise it is 80 columns for the pty without the size,
+// and the longer prompt with the exit code and directory, or the command line, is scrolled with the start cut off.
+const shellColumns = "COLUMNS=10000"
+
+type SandboxOptions = sandbox.Options
+
 // CommandExecutorTool represents a tool that executes commands using exec.Command.
 type CommandExecutorTool struct {
+	// Sandbox, if set, runs the shell in the user, mount, PID and network namespaces
+	// with the read-only host root, the writable workspace and the resource limits.
+	Sandbox *SandboxOptions
+	// Timeout of the commands not setting it, DefaultCommandTimeout if zero.
+	Timeout time.Duration
+	// MaxTimeout caps the commands timeout and the jobs wait, unlimited if zero.
+	MaxTimeout time.Duration
+	// MaxOutput is the command stdout and stderr size limit, their tails are kept. DefaultCommandMaxOutput if zero.
+	MaxOutput int
+
+	mu      sync.Mutex
 	tempDir *string
+	sandbox *sandbox.Sandbox
 
-	process *gexpect.ExpectSubprocess
+	process *terminal.Terminal
 	prompt  string
+	marker  string
+	// stderrFile is where the commands stderr is appended to
+	stderrFile string
+
+	jobsMu    sync.Mutex
+	jobs      map[int]*commandJob
+	lastJobID int
 }
 
 // Call executes the command with the given arguments.
-func (s *CommandExecutorTool) Call(ctx context.Context, input string) (string, error) {
-	commandExecutorArgs := CommandExecutorArgs{}
-	if err := json.Unmarshal([]byte(input), &commandExecutorArgs); err != nil {
-		return "", err
-	}
-
-	return s.RunCommand(commandExecutorArgs.Command)
+func (s *CommandExecutorTool) Call(ctx context.Context, args CommandExecutorArgs) (string, error) {
+	return s.RunCommandTimeout(ctx, args.Command, time.Duration(args.Timeout)*time.Second)
 }
 
 func (s *CommandExecutorTool) RunCommand(input string) (string, error) {
-	if s.tempDir == nil {
-		tDir, err := os.MkdirTemp("", "libagent_command_executor_session_")
-		if err != nil {
-			return "", err
-		}
-		log.Debug().Msgf("command executor temp directory %s created", tDir)
-		s.tempDir = &tDir
+	return s.RunCommandTimeout(context.Background(), input, 0)
+}
 
-		s.process, err = gexpect.SpawnAtDirectory("env -i bash --norc --noprofile", *s.tempDir)
-		if err != nil {
-			return "", fmt.Errorf("spawn: %w", err)
-		}
-		// Start recording buffer
-		s.process.Capture()
-		// Expect default bash shell prompt end
-		if err := s.process.Expect("$"); err != nil {
-			return "", fmt.Errorf("expect initial prompt: %w", err)
-		}
+// RunCommandTimeout runs the command in the shell session, see Execute, and renders its result.
+func (s *CommandExecutorTool) RunCommandTimeout(ctx context.Context, input string, timeout time.Duration) (string, error) {
+	result, err := s.Execute(ctx, input, timeout)
+	if err != nil {
+		return "", err
+	}
+	return result.String(), nil
+}
 
-		if err := s.process.Send(fmt.Sprintf("PATH=%s\n", os.Getenv("PATH"))); err != nil {
-			return "", fmt.Errorf("set PATH: %w", err)
-		}
-		// Create a random UUID to set as a prompt to be sure that there are command end
-		s.prompt = uuid.New().String()
-		if err := s.process.Send(fmt.Sprintf("PS1=%s\n", s.prompt)); err != nil {
-			return "", fmt.Errorf("set prompt: %w", err)
-		}
-		// Expect sent command
-		if err := s.process.Expect(fmt.Sprintf("PS1=%s", s.prompt)); err != nil {
-			return "", fmt.Errorf("expect prompt confirmation: %w", err)
-		}
-		// Expect changed prompt
-		if err := s.process.Expect(s.prompt); err != nil {
-			return "", fmt.Errorf("expect prompt change: %w", err)
-		}
-		// Discard output by draining output buffer
-		s.process.Collect()
+// Execute runs the command in the shell session and interrupts it with Ctrl-C after the timeout,
+// the tool Timeout if zero, or when the context is done, returning the context error then.
+// The command stderr is redirected to the session file to be separated from stdout,
+// the exit code and the working directory are taken from the prompt.
+func (s *CommandExecutorTool) Execute(ctx context.Context, input string, timeout time.Duration) (CommandResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return CommandResult{}, err
+	}
+	if err := s.start(); err != nil {
+		return CommandResult{}, err
 	}
 
 	// Trim trailing '\' to avoid escaping last '\n' symbol
@@ -103,54 +115,327 @@ func (s *CommandExecutorTool) RunCommand(input string) (string, error) {
 			strings.TrimSpace(input),
 			`\"`, `"`,
 		), `\`,
-	) + "\n"
-	log.Debug().Msgf("command executor: %s", strings.TrimSpace(command))
-	s.process.Capture()
-	if err := s.process.Send(command); err != nil {
-		return "", fmt.Errorf("send command: %w", err)
+	)
+	log.Debug().Msgf("command executor: %s", command)
+	started := time.Now()
+	// The group keeps the command effects on the shell, e.g. cd, while its stderr is appended to the file
+	if err := s.process.Send(fmt.Sprintf("{ %s\n} 2>>'%s'\n", command, s.stderrFile)); err != nil {
+		return CommandResult{}, fmt.Errorf("send command: %w", err)
 	}
-	err := s.process.ExpectTimeout(s.prompt, time.Second*30)
-	if err != nil {
+
+	result := CommandResult{Command: command}
+	timeout = s.timeout(timeout)
+	err := s.process.Expect(ctx, s.prompt, timeout)
+	var ctxErr error
+	if err != nil && errors.Is(err, ctx.Err()) {
+		ctxErr = err
+	}
+	if errors.Is(err, terminal.ErrTimeout) || ctxErr != nil {
+		result.TimedOut = ctxErr == nil
+		log.Debug().Err(err).Msgf("command executor interrupt after %s", time.Since(started))
 		if sendErr := s.process.Send(string([]byte{0x03})); sendErr != nil {
 			log.Warn().Err(sendErr).Msg("command executor interrupt send")
 		}
+		// The prompt following the interrupt is consumed, so it is not taken as the next command end
+		err = s.process.Expect(context.Background(), s.prompt, commandInterruptWait)
+	}
+	result.Duration = time.Since(started)
+
+	s.parseOutput(&result, s.process.Collect())
+	stderr, stderrErr := s.readStderr()
+	if stderrErr != nil {
+		log.Warn().Err(stderrErr).Msg("command executor stderr")
+	}
+	result.Stderr = commandOutput(stderr)
+	switch {
+	case errors.Is(err, terminal.ErrTimeout):
+		// The command ignored the interrupt, e.g. an interactive program, so the session is not usable anymore
+		log.Warn().Msg("command executor interrupt ignored, shell killed")
+		result.Dir, result.Restarted = "", true
+		s.cleanup()
+	case err != nil:
+		// The shell has exited, e.g. with the exit command
+		log.Debug().Err(err).Msg("command executor shell exited")
+		result.ExitCode, result.Dir = s.shellExitCode(), ""
+		s.cleanup()
+	}
+
+	maxOutput := s.MaxOutput
+	if maxOutput <= 0 {
+		maxOutput = DefaultCommandMaxOutput
+	}
+	var stdoutCut, stderrCut bool
+	result.Stdout, stdoutCut = outputTail(result.Stdout, maxOutput)
+	result.Stderr, stderrCut = outputTail(result.Stderr, maxOutput)
+	result.Truncated = stdoutCut || stderrCut
+
+	log.Debug().Msgf("command result: %s", result)
+
+	return result, ctxErr
+}
+
+// parseOutput splits the collected terminal output into the command output, following the PS0 marker,
+// and the exit code and working directory between the PS1 marker and the prompt.
+func (s *CommandExecutorTool) parseOutput(result *CommandResult, output string) {
+	result.ExitCode = -1
+	if end := strings.LastIndex(output, s.prompt); end >= 0 {
+		output = output[:end]
+		if statusStart := strings.LastIndex(output, s.marker); statusStart >= 0 {
+			exitCode, dir, _ := strings.Cut(output[statusStart+len(s.marker):], ":")
+			if code, err := strconv.Atoi(exitCode); err == nil {
+				result.ExitCode = code
+			}
+			result.Dir = dir
+			output = output[:statusStart]
+		}
+	}
+	if outputStart := strings.Index(output, s.marker); outputStart >= 0 {
+		output = output[outputStart+len(s.marker):]
+	} else {
+		// The command was not read completely, e.g. the interrupted unterminated quote, there is only its echo
+		output = ""
 	}
+	result.Stdout = commandOutput(output)
+}
 
-	output := string(s.process.Collect())
-	// Collected output will include prompt and entered command line
-	// Strip the first line and trim prompt suffix (since output command can be terminated without newline)
-	outputLines := strings.Split(strings.TrimSpace(output), "\n")[1:]
-	output = strings.TrimSpace(strings.TrimSuffix(strings.Join(outputLines, "\n"), s.prompt))
+// shellExitCode closes the exited shell and returns its exit code.
+func (s *CommandExecutorTool) shellExitCode() int {
+	if err := s.process.Close(); err != nil {
+		log.Debug().Err(err).Msg("command executor shell close")
+	}
+	err := s.process.Wait()
+	s.process = nil
 
-	log.Debug().Msgf("command output: %s", output)
+	exitErr := &exec.ExitError{}
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr):
+		return exitErr.ExitCode()
+	default:
+		return -1
+	}
+}
 
-	return output, nil
+// readStderr returns the stderr appended since the previous command and truncates the file.
+func (s *CommandExecutorTool) readStderr() (string, error) {
+	stderr, err := os.ReadFile(s.stderrFile)
+	if err != nil {
+		return "", err
+	}
+	// The file is opened in the append mode, so the writers left running continue from the start
+	return string(stderr), os.Truncate(s.stderrFile, 0)
 }
 
+// start spawns the shell session if there is none, s.mu is held by the caller.
+func (s *CommandExecutorTool) start() error {
+	if s.tempDir != nil {
+		return nil
+	}
+
+	if err := s.spawn(); err != nil {
+		s.cleanup()
+		return err
+	}
+	// Expect default bash shell prompt end, the failed sandbox setup exits with its error output
+	if err := s.process.Expect(context.Background(), "$", 0); err != nil {
+		output := s.process.Collect()
+		s.cleanup()
+		return fmt.Errorf("expect initial prompt: %w: %s", err, output)
+	}
+
+	if err := s.process.Send(fmt.Sprintf("PATH=%s\n", os.Getenv("PATH"))); err != nil {
+		return fmt.Errorf("set PATH: %w", err)
+	}
+	// Create a random UUID to set as a prompt to be sure that there are command end,
+	// and the marker printed before the command output (PS0) and before its exit code and directory in the prompt
+	s.prompt, s.marker = uuid.New().String(), uuid.New().String()
+	// The prompt is split by the empty quotes, so the echoed command does not match it
+	// COLUMNS is only needed for the readline initialization, it is not passed to the commands
+	if err := s.process.Send(fmt.Sprintf("unset COLUMNS; PS0=%s PS1=%s'${?}:${PWD}'%s\n",
+		splitQuoted(s.marker), splitQuoted(s.marker), splitQuoted(s.prompt),
+	)); err != nil {
+		return fmt.Errorf("set prompt: %w", err)
+	}
+	// Expect changed prompt
+	if err := s.process.Expect(context.Background(), s.prompt, 0); err != nil {
+		return fmt.Errorf("expect prompt change: %w", err)
+	}
+	// Discard output by draining output buffer
+	s.process.Collect()
+	return nil
+}
+
+func splitQuoted(value string) string {
+	half := len(value) / 2
+	return value[:half] + "''" + value[half:]
+}
+
+// timeout returns the tool Timeout if the timeout is not set, capped by the MaxTimeout.
+func (s *CommandExecutorTool) timeout(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		timeout = s.Timeout
+	}
+	if timeout <= 0 {
+		timeout = DefaultCommandTimeout
+	}
+	if s.MaxTimeout > 0 {
+		timeout = min(timeout, s.MaxTimeout)
+	}
+	return timeout
+}
+
+// spawn starts the shell in the session temp directory, or in the sandbox workspace.
+func (s *CommandExecutorTool) spawn() error {
+	if s.Sandbox == nil {
+		tDir, err := os.MkdirTemp("", "libagent_command_executor_session_")
+		if err != nil {
+			return err
+		}
+		log.Debug().Msgf("command executor temp directory %s created", tDir)
+		s.tempDir = &tDir
+
+		// The stderr file is kept out of the working directory
+		stderrFile, err := os.CreateTemp("", "libagent_command_executor_stderr_")
+		if err != nil {
+			return err
+		}
+		s.stderrFile = stderrFile.Name()
+		if err := stderrFile.Close(); err != nil {
+			return err
+		}
+
+		// The prompt is set explicitly, as the default one ends with "#" instead of "$" for root
+		cmd := exec.Command("env", "-i", shellColumns, "PS1=$ ", "bash", "--norc", "--noprofile")
+		cmd.Dir = *s.tempDir
+		s.process, err = terminal.Start(cmd)
+		return err
+	}
+
+	sb, err := sandbox.New(*s.Sandbox)
+	if err != nil {
+		return err
+	}
+	log.Debug().Msgf("command executor sandbox workspace %s created", sb.Workspace)
+	s.sandbox, s.tempDir = sb, &sb.Workspace
+	s.stderrFile = filepath.Join(sb.State, "stderr")
+	if err := os.WriteFile(s.stderrFile, nil, 0o644); err != nil {
+		return err
+	}
+
+	cmd, err := sb.Command("env", shellColumns, "bash", "--norc", "--noprofile")
+	if err != nil {
+		return err
+	}
+	// The process is only set once started, so the failed start is not closed
+	s.process, err = terminal.Start(cmd)
+	return err
+}
+
+// close kills the background jobs and shuts the shell session down.
+func (s *CommandExecutorTool) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.killJobs()
+	return s.cleanup()
+}
+
+// cleanup shuts the shell session down, s.mu is held by the caller.
 func (s *CommandExecutorTool) cleanup() error {
 	if s.tempDir == nil {
 		return nil
 	}
 
 	log.Debug().Msgf("command executor remove temp directory and process shutdown %s", *s.tempDir)
-	err := os.RemoveAll(*s.tempDir)
-	s.tempDir = nil
+	var processErr error
+	if s.process != nil {
+		processErr = s.process.Close()
+		// The killed shell is reaped, its wait error is the kill signal
+		s.process.Wait()
+		s.process = nil
+	}
+
+	var err error
+	if s.sandbox != nil {
+		// The sandbox is removed after the shell is killed, as it holds the sandbox mounts
+		err = s.sandbox.Close()
+		s.sandbox = nil
+	} else {
+		err = errors.Join(os.RemoveAll(*s.tempDir), os.Remove(s.stderrFile))
+	}
+	s.tempDir, s.stderrFile = nil, ""
 	if err != nil {
 		log.Warn().Err(err).Msg("Removing temp dir")
 	}
 
-	return s.process.Close()
+	return processErr
+}
+
+// NewCommandExecutorTool returns the command executor tool with its own shell session,
+// sandboxed if the sandbox options are set, e.g. to pass to WithToolsOverride with the session network access.
+// The background jobs tools share the session only if provided with it by Tools.
+func NewCommandExecutorTool(sandboxOptions *SandboxOptions) *ToolData {
+	return (&CommandExecutorTool{Sandbox: sandboxOptions}).Tools()[0]
+}
+
+// Tools returns the command executor tool and the background jobs tools sharing its session,
+// e.g. to pass to WithToolsOverride with the session sandbox options.
+func (s *CommandExecutorTool) Tools() []*ToolData {
+	return s.tools(CommandExecutorDefinition)
+}
+
+func (s *CommandExecutorTool) tools(definition llms.FunctionDefinition) []*ToolData {
+	commandExecutor := tools.NewTool(
+		definition.Name,
+		definition.Description,
+		s.Call,
+	)
+	// The replan starts with the new shell session and workspace, so the jobs running in the old one are killed too
+	commandExecutor.Reset = func(context.Context) error {
+		return s.close()
+	}
+	toolsData := append([]*ToolData{commandExecutor}, s.jobTools()...)
+	// Any of the tools shuts the shared session down, so it is done even if some of them are not used
+	for _, tool := range toolsData {
+		tool.Cleanup = s.close
+	}
+	return toolsData
+}
+
+// configCommandExecutor returns the command executor configured with the COMMAND_EXECUTOR_ options.
+func configCommandExecutor(cfg config.Config) *CommandExecutorTool {
+	return &CommandExecutorTool{
+		Sandbox:    configSandboxOptions(cfg),
+		Timeout:    time.Duration(cfg.CommandExecutorTimeout) * time.Second,
+		MaxTimeout: time.Duration(cfg.CommandExecutorMaxTimeout) * time.Second,
+		MaxOutput:  cfg.CommandExecutorMaxOutput,
+	}
+}
+
+// configSandboxOptions returns the config COMMAND_EXECUTOR_SANDBOX_ options, nil if the sandbox is disabled.
+func configSandboxOptions(cfg config.Config) *SandboxOptions {
+	if !cfg.CommandExecutorSandbox {
+		return nil
+	}
+	return &SandboxOptions{
+		Network:   cfg.CommandExecutorSandboxNetwork,
+		CPUTime:   time.Duration(cfg.CommandExecutorSandboxCPUTime) * time.Second,
+		Memory:    int64(cfg.CommandExecutorSandboxMemory) << 20,
+		Processes: cfg.CommandExecutorSandboxProcesses,
+		FileSize:  int64(cfg.CommandExecutorSandboxFileSize) << 20,
+		Cgroup:    cfg.CommandExecutorSandboxCgroup,
+		CPUQuota:  cfg.CommandExecutorSandboxCPUQuota,
+	}
 }
 
 func init() {
-	globalToolsRegistry = append(globalToolsRegistry,
-		func(ctx context.Context, cfg config.Config) (*tools.ToolData, error) {
+	MustRegisterProvider(CommandExecutorDefinition.Name,
+		func(ctx context.Context, cfg config.Config, executor *ToolsExecutor) ([]*ToolData, error) {
 			if cfg.CommandExecutorDisable {
 				return nil, nil
 			}
 
-			commandExecutorTool := CommandExecutorTool{}
-
 			definition := CommandExecutorDefinition
 			if len(cfg.CommandExecutorCommands) > 0 {
 				commandsList := ""
@@ -181,11 +466,7 @@ func init() {
 				definition.Description = strings.TrimSuffix(definition.Description, "\n")
 			}
 
-			return &tools.ToolData{
-				Definition: definition,
-				Call:       commandExecutorTool.Call,
-				Cleanup:    commandExecutorTool.cleanup,
-			}, nil
+			return configCommandExecutor(cfg).tools(definition), nil
 		},
 	)
 }
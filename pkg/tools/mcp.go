@@ -0,0 +1,88 @@
+package tools
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/Swarmind/libagent/internal/tools/mcpClient"
+	"github.com/Swarmind/libagent/internal/tools/mcpServer"
+	"github.com/Swarmind/libagent/pkg/config"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rs/zerolog/log"
+)
+
+const MCPProviderName = "mcp"
+
+// DefaultMCPSessionTimeout is the NewMCPHandler idle session timeout if its options do not set one.
+const DefaultMCPSessionTimeout = mcpServer.DefaultSessionTimeout
+
+func init() {
+	MustRegisterProvider(MCPProviderName,
+		func(ctx context.Context, cfg config.Config, executor *ToolsExecutor) ([]*ToolData, error) {
+			mcpTools := []*ToolData{}
+			names := map[string]bool{}
+			for _, name := range slices.Sorted(maps.Keys(cfg.MCPServers)) {
+				server, err := mcpClient.NewServer(strings.ToLower(name), cfg.MCPServers[name])
+				if err != nil {
+					return nil, err
+				}
+				// The server is not started if none of its tools can be whitelisted
+				if !ProviderWhitelisted(ctx, MCPProviderName, server.ToolName("")) {
+					continue
+				}
+
+				// An unreachable server is skipped, so it does not break the other tools
+				serverTools, err := server.Tools(ctx)
+				if err != nil {
+					log.Warn().Err(err).Msgf("mcp server %s skipped", server.Name)
+					if err := server.Close(); err != nil {
+						log.Warn().Err(err).Msgf("mcp server %s close", server.Name)
+					}
+					continue
+				}
+				log.Debug().Msgf("mcp server %s provided %d tools", server.Name, len(serverTools))
+				kept := 0
+				for _, tool := range serverTools {
+					// The tools sharing the session are not released one by one, so the unused ones are dropped here
+					if !providerToolWhitelisted(ctx, MCPProviderName, tool.Definition.Name) {
+						continue
+					}
+					// The sanitized names can collide, e.g. "a.b" and "a_b", the first tool is kept
+					if names[tool.Definition.Name] {
+						log.Warn().Msgf("mcp server %s tool %s skipped: duplicate name", server.Name, tool.Definition.Name)
+						continue
+					}
+					names[tool.Definition.Name] = true
+					mcpTools = append(mcpTools, tool)
+					kept++
+				}
+				if kept == 0 {
+					if err := server.Close(); err != nil {
+						log.Warn().Err(err).Msgf("mcp server %s close", server.Name)
+					}
+				}
+			}
+			return mcpTools, nil
+		},
+	)
+}
+
+// ServeMCPStdio serves the executor tools as an MCP server over stdio, cleaning up the executor on the session end.
+func ServeMCPStdio(ctx context.Context, executor *ToolsExecutor) error {
+	return mcpServer.ServeStdio(ctx, executor)
+}
+
+// NewMCPHandler serves the tools as an MCP server over streamable HTTP,
+// with a new executor built by newExecutor for every session and cleaned up on its end.
+// The sessions idle for the opts SessionTimeout, DefaultMCPSessionTimeout if not set, are closed.
+func NewMCPHandler(
+	ctx context.Context,
+	newExecutor func(context.Context) (*ToolsExecutor, error),
+	opts *mcp.StreamableHTTPOptions,
+) http.Handler {
+	return mcpServer.NewHTTPHandler(ctx, newExecutor, opts)
+}
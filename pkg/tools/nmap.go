@@ -2,42 +2,26 @@ package tools
 
 import (
 	"context"
-	"encoding/json"
 	"os/exec"
 
 	"github.com/Swarmind/libagent/internal/tools"
 	"github.com/Swarmind/libagent/pkg/config"
-
-	"github.com/tmc/langchaingo/llms"
 )
 
-var NmapToolDefinition = llms.FunctionDefinition{
-	Name:        "nmap",
-	Description: "Executes nmap -v -T4 -PA -sV --version-all --osscan-guess -A -sS -p 1-65535 [IP], where IP is the call argument.",
-	Parameters: map[string]any{
-		"type": "object",
-		"properties": map[string]any{
-			"ip": map[string]any{
-				"type":        "string",
-				"description": "The valid IP address to scan to.",
-			},
-		},
-	},
+type NmapToolArgs struct {
+	IP string `json:"ip" description:"The valid IP address to scan to." required:"true" pattern:"^[0-9A-Za-z][0-9A-Za-z.:/-]*$"`
 }
 
-type NmapTool struct{}
+var NmapToolDefinition = tools.Definition[NmapToolArgs](
+	"nmap",
+	"Executes nmap -v -T4 -PA -sV --version-all --osscan-guess -A -sS -p 1-65535 [IP], where IP is the call argument.",
+)
 
-type NmapToolArgs struct {
-	IP string `json:"ip"`
-}
+type NmapTool struct{}
 
 // Call executes the command with the given arguments.
-func (s NmapTool) Call(ctx context.Context, input string) (string, error) {
-	nmapToolArgs := NmapToolArgs{}
-	if err := json.Unmarshal([]byte(input), &nmapToolArgs); err != nil {
-		return "", err
-	}
-	cmd := exec.Command("nmap", "-v", "-T4", "-PA", "-sV", "--version-all", "-osscan-guess", "-A", "-sS", "-p", "1-65535", nmapToolArgs.IP)
+func (s NmapTool) Call(ctx context.Context, args NmapToolArgs) (string, error) {
+	cmd := exec.CommandContext(ctx, "nmap", "-v", "-T4", "-PA", "-sV", "--version-all", "-osscan-guess", "-A", "-sS", "-p", "1-65535", args.IP)
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -47,16 +31,22 @@ func (s NmapTool) Call(ctx context.Context, input string) (string, error) {
 }
 
 func init() {
-	globalToolsRegistry = append(globalToolsRegistry,
-		func(ctx context.Context, cfg config.Config) (*tools.ToolData, error) {
+	MustRegister(NmapToolDefinition.Name,
+		func(ctx context.Context, cfg config.Config, executor *ToolsExecutor) (*ToolData, error) {
 			if cfg.NmapDisable {
 				return nil, nil
 			}
 
-			return &tools.ToolData{
-				Definition: NmapToolDefinition,
-				Call:       NmapTool{}.Call,
-			}, nil
+			tool := tools.NewTool(
+				NmapToolDefinition.Name,
+				NmapToolDefinition.Description,
+				NmapTool{}.Call,
+			)
+			tool.Health = func(ctx context.Context) error {
+				_, err := exec.LookPath("nmap")
+				return err
+			}
+			return tool, nil
 		},
 	)
 }
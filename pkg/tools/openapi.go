@@ -0,0 +1,65 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/Swarmind/libagent/internal/tools/openapi"
+	"github.com/Swarmind/libagent/pkg/config"
+
+	"github.com/rs/zerolog/log"
+)
+
+const OpenAPIProviderName = "openapi"
+
+type OpenAPIOptions = openapi.Options
+
+// LoadOpenAPITools builds a tool per operation of the OpenAPI 3 document file or URL.
+func LoadOpenAPITools(ctx context.Context, source string, opts OpenAPIOptions) ([]*ToolData, error) {
+	doc, err := openapi.Load(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Tools(opts)
+}
+
+func init() {
+	MustRegisterProvider(OpenAPIProviderName,
+		func(ctx context.Context, cfg config.Config, executor *ToolsExecutor) ([]*ToolData, error) {
+			openAPITools := []*ToolData{}
+			for _, key := range slices.Sorted(maps.Keys(cfg.OpenAPISpecs)) {
+				opts := OpenAPIOptions{
+					Name:    strings.ToLower(key),
+					BaseURL: cfg.OpenAPIBaseURLs[key],
+				}
+				if header := cfg.OpenAPIAuthHeaders[key]; header != "" {
+					name, value, ok := strings.Cut(header, ":")
+					if !ok {
+						return nil, fmt.Errorf("openapi %s auth header is not in the \"Name: value\" format", opts.Name)
+					}
+					opts.Headers = map[string]string{
+						strings.TrimSpace(name): strings.TrimSpace(value),
+					}
+				}
+				for _, operation := range strings.Split(cfg.OpenAPIOperations[key], ",") {
+					if operation = strings.TrimSpace(operation); operation != "" {
+						opts.Operations = append(opts.Operations, operation)
+					}
+				}
+
+				// An unavailable document is skipped, so it does not break the other tools
+				specTools, err := LoadOpenAPITools(ctx, cfg.OpenAPISpecs[key], opts)
+				if err != nil {
+					log.Warn().Err(err).Msgf("openapi %s skipped", opts.Name)
+					continue
+				}
+				log.Debug().Msgf("openapi %s provided %d tools", opts.Name, len(specTools))
+				openAPITools = append(openAPITools, specTools...)
+			}
+			return openAPITools, nil
+		},
+	)
+}
@@ -0,0 +1,47 @@
+package tools
+
+import (
+	"context"
+	"time"
+
+	"github.com/Swarmind/libagent/internal/tools/plugin"
+	"github.com/Swarmind/libagent/pkg/config"
+
+	"github.com/rs/zerolog/log"
+)
+
+const PluginsProviderName = "plugins"
+
+type PluginOptions = plugin.Options
+
+// LoadPluginTools loads the tools of the plugin executable, see the plugin package for the protocol.
+func LoadPluginTools(ctx context.Context, path string, opts PluginOptions) ([]*ToolData, error) {
+	p, err := plugin.Load(ctx, path, opts)
+	if err != nil {
+		return nil, err
+	}
+	return p.Tools(), nil
+}
+
+func init() {
+	MustRegisterProvider(PluginsProviderName,
+		func(ctx context.Context, cfg config.Config, executor *ToolsExecutor) ([]*ToolData, error) {
+			if cfg.ToolPluginDir == "" {
+				return nil, nil
+			}
+			plugins, err := plugin.Discover(ctx, cfg.ToolPluginDir, PluginOptions{
+				Timeout: time.Duration(cfg.ToolPluginTimeout) * time.Second,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			pluginTools := []*ToolData{}
+			for _, p := range plugins {
+				log.Debug().Msgf("plugin %s provided %d tools", p.Name, len(p.Description.Tools))
+				pluginTools = append(pluginTools, p.Tools()...)
+			}
+			return pluginTools, nil
+		},
+	)
+}
@@ -2,74 +2,109 @@ package tools
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 
 	"github.com/Swarmind/libagent/internal/tools"
 	"github.com/Swarmind/libagent/internal/tools/rewoo"
 	"github.com/Swarmind/libagent/pkg/config"
 
 	graph "github.com/JackBekket/langgraphgo/graph/stategraph"
-	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/llms/openai"
 )
 
-var ReWOOToolDefinition = llms.FunctionDefinition{
-	Name: "rewoo",
-	Description: `A more complex LLM Reasoning algorithm.
+type ReWOOToolArgs struct {
+	Query string `json:"query" description:"The task query" required:"true" minLength:"1"`
+}
+
+var ReWOOToolDefinition = tools.Definition[ReWOOToolArgs](
+	"rewoo",
+	`A more complex LLM Reasoning algorithm.
 Useful when you need to do a tool assisted reasoning research.
 Usually tends to return a short response as a result of multiple step thinking.
 Use it is you think that you have an isolated complex research subtask.
 Input can be any complex task.`,
-	Parameters: map[string]any{
-		"type": "object",
-		"properties": map[string]any{
-			"query": map[string]any{
-				"type":        "string",
-				"description": "The task query",
-			},
-		},
-	},
+)
+
+// ReWOOTrace is a ReWOO run record with the nested runs as its children.
+type ReWOOTrace = rewoo.Trace
+
+// WithReWOOTraceHandler sets the handler receiving the trace of every top level ReWOO run called with the context.
+func WithReWOOTraceHandler(ctx context.Context, handler func(*ReWOOTrace)) context.Context {
+	return rewoo.ContextWithTraceHandler(ctx, handler)
 }
 
-type ReWOOToolArgs struct {
-	Query string `json:"query"`
+type ReWOOProgressEvent = rewoo.ProgressEvent
+type ReWOOProgressListener = rewoo.ProgressListener
+
+const (
+	ReWOOProgressPlanReady    = rewoo.ProgressPlanReady
+	ReWOOProgressStepStarted  = rewoo.ProgressStepStarted
+	ReWOOProgressStepFinished = rewoo.ProgressStepFinished
+	ReWOOProgressReplan       = rewoo.ProgressReplan
+	ReWOOProgressSolved       = rewoo.ProgressSolved
+)
+
+// WithReWOOProgress sets the listener receiving the progress events of the ReWOO runs called with the context,
+// nested runs included.
+func WithReWOOProgress(ctx context.Context, listener ReWOOProgressListener) context.Context {
+	return rewoo.ContextWithProgressListener(ctx, listener)
 }
 
+// ReWOOTool is bound to the tools executor of its ReWOO, which is set before the graph initialization.
 type ReWOOTool struct {
 	ReWOO rewoo.ReWOO
 	graph *graph.Runnable
 }
 
-func (t *ReWOOTool) Call(ctx context.Context, input string) (string, error) {
-	rewooToolArgs := ReWOOToolArgs{}
-	if err := json.Unmarshal([]byte(input), &rewooToolArgs); err != nil {
-		return "", err
-	}
-
-	if t.ReWOO.ToolsExecutor == nil {
-		t.ReWOO.ToolsExecutor = globalToolsExecutor
+func NewReWOOTool(r rewoo.ReWOO) (*ReWOOTool, error) {
+	if r.ToolsExecutor == nil {
+		return nil, fmt.Errorf("rewoo tool without tools executor")
 	}
-	if t.graph == nil {
-		if g, err := t.ReWOO.InitializeGraph(); err != nil {
-			return "", err
-		} else {
-			t.graph = g
-		}
+	g, err := r.InitializeGraph()
+	if err != nil {
+		return nil, err
 	}
+	return &ReWOOTool{
+		ReWOO: r,
+		graph: g,
+	}, nil
+}
 
-	state, err := t.graph.Invoke(ctx, &rewoo.State{
-		Task: rewooToolArgs.Query,
-	})
+func (t *ReWOOTool) Call(ctx context.Context, args ReWOOToolArgs) (string, error) {
+	state, err := t.ReWOO.Invoke(ctx, t.graph, args.Query)
 	if err != nil {
 		return "", err
 	}
 
-	return state.(*rewoo.State).Result, nil
+	return state.Result, nil
+}
+
+// newReWOORoleLLM returns nil if the role has no model configured, so the default ReWOO LLM is used.
+func newReWOORoleLLM(cfg config.Config, aiURL, aiToken, model string) (*openai.LLM, error) {
+	if aiURL == "" && aiToken == "" && model == "" {
+		return nil, nil
+	}
+	if aiURL == "" {
+		aiURL = cfg.AIURL
+	}
+	if aiToken == "" {
+		aiToken = cfg.AIToken
+	}
+	if model == "" {
+		model = cfg.Model
+	}
+
+	return openai.New(
+		openai.WithBaseURL(aiURL),
+		openai.WithToken(aiToken),
+		openai.WithModel(model),
+		openai.WithAPIVersion("v1"),
+	)
 }
 
 func init() {
-	globalToolsRegistry = append(globalToolsRegistry,
-		func(ctx context.Context, cfg config.Config) (*tools.ToolData, error) {
+	MustRegister(ReWOOToolDefinition.Name,
+		func(ctx context.Context, cfg config.Config, executor *ToolsExecutor) (*ToolData, error) {
 			if cfg.ReWOODisable {
 				return nil, nil
 			}
@@ -83,17 +118,71 @@ func init() {
 				return nil, err
 			}
 
-			rewooTool := ReWOOTool{
-				ReWOO: rewoo.ReWOO{
-					LLM:                llm,
-					DefaultCallOptions: config.ConifgToCallOptions(cfg.RewOODefaultCallOptions),
+			plannerLLM, err := newReWOORoleLLM(cfg,
+				cfg.ReWOOPlannerAIURL, cfg.ReWOOPlannerAIToken, cfg.ReWOOPlannerModel,
+			)
+			if err != nil {
+				return nil, fmt.Errorf("rewoo planner llm: %w", err)
+			}
+			workerLLM, err := newReWOORoleLLM(cfg,
+				cfg.ReWOOWorkerAIURL, cfg.ReWOOWorkerAIToken, cfg.ReWOOWorkerModel,
+			)
+			if err != nil {
+				return nil, fmt.Errorf("rewoo worker llm: %w", err)
+			}
+			solverLLM, err := newReWOORoleLLM(cfg,
+				cfg.ReWOOSolverAIURL, cfg.ReWOOSolverAIToken, cfg.ReWOOSolverModel,
+			)
+			if err != nil {
+				return nil, fmt.Errorf("rewoo solver llm: %w", err)
+			}
+
+			retryAction, err := rewoo.ParseRetryAction(cfg.ReWOORetryAction)
+			if err != nil {
+				return nil, err
+			}
+
+			evidenceMode, err := rewoo.ParseEvidenceMode(cfg.ReWOOEvidenceMode)
+			if err != nil {
+				return nil, err
+			}
+
+			toolSelector, err := NewToolSelector(cfg)
+			if err != nil {
+				return nil, err
+			}
+
+			rewooTool, err := NewReWOOTool(rewoo.ReWOO{
+				LLM:                llm,
+				ToolsExecutor:      executor,
+				ToolName:           ReWOOToolDefinition.Name,
+				AllowNested:        cfg.ReWOOAllowNested,
+				MaxDepth:           cfg.ReWOOMaxDepth,
+				DefaultCallOptions: config.ConifgToCallOptions(cfg.RewOODefaultCallOptions),
+				PlannerLLM:         plannerLLM,
+				PlannerCallOptions: config.ConifgToCallOptions(cfg.ReWOOPlannerDefaultCallOptions),
+				WorkerLLM:          workerLLM,
+				WorkerCallOptions:  config.ConifgToCallOptions(cfg.ReWOOWorkerDefaultCallOptions),
+				SolverLLM:          solverLLM,
+				SolverCallOptions:  config.ConifgToCallOptions(cfg.ReWOOSolverDefaultCallOptions),
+				RetryPolicy: rewoo.RetryPolicy{
+					Action:     retryAction,
+					MaxRetries: cfg.ReWOORetryMax,
 				},
+				EvidenceMaxSize:   cfg.ReWOOEvidenceMaxSize,
+				EvidenceMode:      evidenceMode,
+				EvidenceChunkSize: cfg.ReWOOEvidenceChunkSize,
+				ToolSelector:      toolSelector,
+			})
+			if err != nil {
+				return nil, err
 			}
 
-			return &tools.ToolData{
-				Definition: ReWOOToolDefinition,
-				Call:       rewooTool.Call,
-			}, nil
+			return tools.NewTool(
+				ReWOOToolDefinition.Name,
+				ReWOOToolDefinition.Description,
+				rewooTool.Call,
+			), nil
 		},
 	)
 }
@@ -0,0 +1,48 @@
+package tools
+
+import (
+	"fmt"
+
+	"github.com/Swarmind/libagent/internal/tools"
+	"github.com/Swarmind/libagent/pkg/config"
+
+	"github.com/tmc/langchaingo/embeddings"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+type ToolSelector = tools.ToolSelector
+type ToolRetriever = tools.ToolRetriever
+type KeywordRetriever = tools.KeywordRetriever
+type EmbeddingRetriever = tools.EmbeddingRetriever
+
+// NewToolSelector builds the tool selector from the config, nil if TOOL_SELECTION_TOP_K is not set.
+// The readMore tool is always on, so the truncated outputs can be read.
+func NewToolSelector(cfg config.Config) (*ToolSelector, error) {
+	if cfg.ToolSelectionTopK <= 0 {
+		return nil, nil
+	}
+
+	var retriever ToolRetriever = KeywordRetriever{}
+	if cfg.ToolSelectionEmbeddingModel != "" {
+		llm, err := openai.New(
+			openai.WithBaseURL(cfg.ToolSelectionAIURL),
+			openai.WithToken(cfg.ToolSelectionAIToken),
+			openai.WithEmbeddingModel(cfg.ToolSelectionEmbeddingModel),
+			openai.WithAPIVersion("v1"),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("tool selection embedding llm: %w", err)
+		}
+		embedder, err := embeddings.NewEmbedder(llm)
+		if err != nil {
+			return nil, fmt.Errorf("tool selection embedder: %w", err)
+		}
+		retriever = &EmbeddingRetriever{Embedder: embedder}
+	}
+
+	return &ToolSelector{
+		Retriever: retriever,
+		TopK:      cfg.ToolSelectionTopK,
+		AlwaysOn:  append([]string{tools.ReadMoreToolName}, cfg.ToolSelectionAlwaysOn...),
+	}, nil
+}
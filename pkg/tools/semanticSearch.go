@@ -2,66 +2,49 @@ package tools
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/Swarmind/libagent/internal/tools"
 	"github.com/Swarmind/libagent/pkg/config"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/tmc/langchaingo/embeddings"
-	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/llms/openai"
 	"github.com/tmc/langchaingo/vectorstores/pgvector"
 )
 
-var SemanticSearchDefinition = llms.FunctionDefinition{
-	Name:        "semanticSearch",
-	Description: "Performs semantic search in the vector store of the saved code blobs. Returns matching file contents",
-	Parameters: map[string]any{
-		"type": "object",
-		"properties": map[string]any{
-			"query": map[string]any{
-				"type":        "string",
-				"description": "The search query",
-			},
-			"collection": map[string]any{ //TODO: there should NOT exist arguments which called NAME cause it cause COLLISION with actual function name.    .....more like confusion then collision so there are no error
-				"type":        "string",
-				"description": "name of collection store in which we perform the search",
-			},
-		},
-	},
-}
-
 type SemanticSearchArgs struct {
-	Query      string `json:"query"`
-	Collection string `json:"collection"`
+	Query      string `json:"query" description:"The search query" required:"true" minLength:"1"`
+	Collection string `json:"collection" description:"name of collection store in which we perform the search" required:"true" minLength:"1"`
 }
 
+var SemanticSearchDefinition = tools.Definition[SemanticSearchArgs](
+	"semanticSearch",
+	"Performs semantic search in the vector store of the saved code blobs. Returns matching file contents",
+)
+
+var errSemanticSearchClosed = errors.New("semantic search is closed")
+
 type SemanticSearchTool struct {
 	OpenAIURL      string
 	OpenAIToken    string
 	DBConnection   string
 	EmbeddingModel string
 	MaxResults     int
-}
-
-func (s SemanticSearchTool) Call(ctx context.Context, input string) (string, error) {
-	semanticSearchArgs := SemanticSearchArgs{}
-	response := ""
 
-	if err := json.Unmarshal([]byte(input), &semanticSearchArgs); err != nil {
-		return response, err
-	}
+	// mu guards the pool from being closed while the calls use it
+	mu       sync.RWMutex
+	pool     *pgxpool.Pool
+	embedder embeddings.Embedder
+}
 
+// Init connects to the database and prepares the embedder, the pool is shared by the calls.
+func (s *SemanticSearchTool) Init(ctx context.Context) error {
 	config, err := pgxpool.ParseConfig(s.DBConnection)
 	if err != nil {
-		return response, err
-	}
-
-	pool, err := pgxpool.NewWithConfig(context.Background(), config)
-	if err != nil {
-		return response, err
+		return err
 	}
 
 	llm, err := openai.New(
@@ -71,24 +54,63 @@ func (s SemanticSearchTool) Call(ctx context.Context, input string) (string, err
 		openai.WithAPIVersion("v1"),
 	)
 	if err != nil {
-		return response, err
+		return err
 	}
 
 	e, err := embeddings.NewEmbedder(llm)
 	if err != nil {
-		return response, err
+		return err
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pool, s.embedder = pool, e
+	return nil
+}
+
+func (s *SemanticSearchTool) Health(ctx context.Context) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.pool == nil {
+		return errSemanticSearchClosed
+	}
+	return s.pool.Ping(ctx)
+}
+
+// Close closes the pool after the running calls are finished.
+func (s *SemanticSearchTool) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pool != nil {
+		s.pool.Close()
+		s.pool = nil
+	}
+	return nil
+}
+
+func (s *SemanticSearchTool) Call(ctx context.Context, semanticSearchArgs SemanticSearchArgs) (string, error) {
+	response := ""
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.pool == nil {
+		return response, errSemanticSearchClosed
 	}
 
+	// The store is not closed, as it would close the shared pool
 	store, err := pgvector.New(
-		context.Background(),
+		ctx,
 		pgvector.WithCollectionName(semanticSearchArgs.Collection),
-		pgvector.WithConn(pool),
-		pgvector.WithEmbedder(e),
+		pgvector.WithConn(s.pool),
+		pgvector.WithEmbedder(s.embedder),
 	)
 	if err != nil {
 		return response, err
 	}
-	defer store.Close()
 
 	searchResults, err := store.SimilaritySearch(ctx, semanticSearchArgs.Query, s.MaxResults)
 	if err != nil {
@@ -103,8 +125,8 @@ func (s SemanticSearchTool) Call(ctx context.Context, input string) (string, err
 }
 
 func init() {
-	globalToolsRegistry = append(globalToolsRegistry,
-		func(ctx context.Context, cfg config.Config) (*tools.ToolData, error) {
+	MustRegister(SemanticSearchDefinition.Name,
+		func(ctx context.Context, cfg config.Config, executor *ToolsExecutor) (*ToolData, error) {
 			if cfg.SemanticSearchDisable {
 				return nil, nil
 			}
@@ -132,10 +154,15 @@ func init() {
 				MaxResults:     cfg.SemanticSearchMaxResults,
 			}
 
-			return &tools.ToolData{
-				Definition: SemanticSearchDefinition,
-				Call:       semanticSearchTool.Call,
-			}, nil
+			tool := tools.NewTool(
+				SemanticSearchDefinition.Name,
+				SemanticSearchDefinition.Description,
+				semanticSearchTool.Call,
+			)
+			tool.Init = semanticSearchTool.Init
+			tool.Health = semanticSearchTool.Health
+			tool.Close = semanticSearchTool.Close
+			return tool, nil
 		},
 	)
 }
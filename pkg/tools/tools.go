@@ -2,54 +2,396 @@ package tools
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"maps"
 	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/Swarmind/libagent/internal/tools"
 	"github.com/Swarmind/libagent/pkg/config"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tmc/langchaingo/llms"
 )
 
+type ToolData = tools.ToolData
+type ToolsExecutor = tools.ToolsExecutor
+type ToolCallError = tools.ToolCallError
+type ValidationError = tools.ValidationError
+type ExecutionPolicy = tools.ExecutionPolicy
+type SetupOptions = tools.SetupOptions
+type ToolExample = tools.ToolExample
+type PromptDescMode = tools.PromptDescMode
+
+const (
+	PromptDescCompact = tools.PromptDescCompact
+	PromptDescVerbose = tools.PromptDescVerbose
+)
+
+var ErrToolUnavailable = tools.ErrToolUnavailable
+
+// ToolFactory builds the tool for the executor being created, nil tool means the tool is disabled.
+// The executor is not populated yet, so it can only be used by the tool at call time.
+type ToolFactory func(ctx context.Context, cfg config.Config, executor *ToolsExecutor) (*ToolData, error)
+
+// ToolsProvider builds a set of tools for the executor being created, e.g. the tools of an external server.
+type ToolsProvider func(ctx context.Context, cfg config.Config, executor *ToolsExecutor) ([]*ToolData, error)
+
+var ErrDuplicateTool = errors.New("duplicate tool name")
+
 type ExecutorOption func(*ExecutorOptions)
 
 type ExecutorOptions struct {
 	ToolsWhitelist []string
+	// Tools are added to the executor along with the registered ones.
+	Tools []*ToolData
+	// OverrideTools are added to the executor replacing the registered ones with the same name.
+	OverrideTools []*ToolData
+	// Policies override DefaultToolPolicies, DefaultPolicy applies to the tools without a policy.
+	Policies      map[string]ExecutionPolicy
+	DefaultPolicy ExecutionPolicy
+	// OutputLimits are the per-tool output limits, DefaultOutputLimit (config TOOL_OUTPUT_LIMIT by default)
+	// applies to the tools without one. The readMore tool is added if any limit is set.
+	OutputLimits       map[string]int
+	DefaultOutputLimit int
+	// Audit records every call, the config AUDIT_LOG_ one is used if nil.
+	Audit *AuditLog
+	// CallPolicy is evaluated before every call, the config TOOL_POLICY_FILE one is used if nil.
+	CallPolicy *CallPolicy
+	Approver   Approver
+	// PromptDescMode is the tools prompt parameters rendering mode, verbose if config TOOL_DESC_VERBOSE is set.
+	PromptDescMode PromptDescMode
+	// Cache caches the results of the tools with the policy CacheTTL, the config TOOL_CACHE_ one is used if nil.
+	Cache *ToolCache
+	// EagerInit initializes the tools on creation, HealthCheck checks them too (config TOOL_EAGER_INIT
+	// and TOOL_HEALTH_CHECK by default). The tools failing either are disabled with a warning.
+	EagerInit   bool
+	HealthCheck bool
+}
+
+// DefaultToolPolicies are the execution policies of the built-in tools, which can be overridden with WithToolPolicy.
+var DefaultToolPolicies = map[string]ExecutionPolicy{
+	DDGSearchDefinition.Name: {
+		Timeout:          30 * time.Second,
+		Idempotent:       true,
+		MaxRetries:       2,
+		BreakerThreshold: 5,
+		CacheTTL:         time.Hour,
+	},
+	WebReaderDefinition.Name: {
+		Timeout:          time.Minute,
+		Idempotent:       true,
+		MaxRetries:       2,
+		BreakerThreshold: 5,
+		CacheTTL:         time.Hour,
+	},
+	SemanticSearchDefinition.Name: {
+		Timeout:          time.Minute,
+		Idempotent:       true,
+		MaxRetries:       1,
+		BreakerThreshold: 3,
+	},
+	NmapToolDefinition.Name: {
+		Timeout: time.Hour,
+	},
+}
+
+type registryEntry struct {
+	name     string
+	factory  ToolFactory
+	provider ToolsProvider
+}
+
+var (
+	globalToolsRegistryMu sync.RWMutex
+	globalToolsRegistry   = []registryEntry{}
+)
+
+// Register adds the tool factory to the registry used by every NewToolsExecutor call.
+// The name should match the built tool definition name, ErrDuplicateTool is returned if it is taken.
+func Register(name string, factory ToolFactory) error {
+	return register(registryEntry{
+		name:    name,
+		factory: factory,
+	})
+}
+
+// RegisterProvider adds the tools provider to the registry used by every NewToolsExecutor call.
+// The provided tools are whitelisted either by the provider name or by their own names.
+func RegisterProvider(name string, provider ToolsProvider) error {
+	return register(registryEntry{
+		name:     name,
+		provider: provider,
+	})
+}
+
+// MustRegisterProvider is RegisterProvider panicking on error, for the init functions.
+func MustRegisterProvider(name string, provider ToolsProvider) {
+	if err := RegisterProvider(name, provider); err != nil {
+		panic(err)
+	}
+}
+
+type toolsWhitelistKey struct{}
+
+// ProviderWhitelisted reports whether the executor whitelist can pass the provider tools named with the namespace prefix,
+// so the provider skips connecting to the sources of the tools that are dropped anyway.
+func ProviderWhitelisted(ctx context.Context, provider, namespace string) bool {
+	whitelist, _ := ctx.Value(toolsWhitelistKey{}).([]string)
+	return len(whitelist) == 0 || slices.Contains(whitelist, provider) ||
+		slices.ContainsFunc(whitelist, func(name string) bool {
+			return strings.HasPrefix(name, namespace)
+		})
+}
+
+// providerToolWhitelisted reports whether the executor whitelist passes the provider tool.
+func providerToolWhitelisted(ctx context.Context, provider, name string) bool {
+	whitelist, _ := ctx.Value(toolsWhitelistKey{}).([]string)
+	return len(whitelist) == 0 || slices.Contains(whitelist, provider) || slices.Contains(whitelist, name)
+}
+
+func register(newEntry registryEntry) error {
+	globalToolsRegistryMu.Lock()
+	defer globalToolsRegistryMu.Unlock()
+
+	if slices.ContainsFunc(globalToolsRegistry, func(entry registryEntry) bool {
+		return entry.name == newEntry.name
+	}) {
+		return fmt.Errorf("%w: %s", ErrDuplicateTool, newEntry.name)
+	}
+	globalToolsRegistry = append(globalToolsRegistry, newEntry)
+	return nil
+}
+
+// MustRegister is Register panicking on error, for the init functions.
+func MustRegister(name string, factory ToolFactory) {
+	if err := Register(name, factory); err != nil {
+		panic(err)
+	}
+}
+
+// Override replaces the registered tool factory, e.g. of a built-in tool, or registers it if there is none.
+func Override(name string, factory ToolFactory) {
+	globalToolsRegistryMu.Lock()
+	defer globalToolsRegistryMu.Unlock()
+
+	for idx, entry := range globalToolsRegistry {
+		if entry.name == name {
+			globalToolsRegistry[idx] = registryEntry{
+				name:    name,
+				factory: factory,
+			}
+			return
+		}
+	}
+	globalToolsRegistry = append(globalToolsRegistry, registryEntry{
+		name:    name,
+		factory: factory,
+	})
 }
 
-var globalToolsRegistry = []func(context.Context, config.Config) (*tools.ToolData, error){}
-var globalToolsExecutor *tools.ToolsExecutor
+// Registered returns the registered tool and provider names in the registration order.
+func Registered() []string {
+	globalToolsRegistryMu.RLock()
+	defer globalToolsRegistryMu.RUnlock()
+
+	names := []string{}
+	for _, entry := range globalToolsRegistry {
+		names = append(names, entry.name)
+	}
+	return names
+}
+
+// NewTool builds the tool from the typed call function, see tools.NewTool.
+func NewTool[Args, Result any](
+	name, description string,
+	call func(context.Context, Args) (Result, error),
+) *ToolData {
+	return tools.NewTool(name, description, call)
+}
 
-func NewToolsExecutor(ctx context.Context, cfg config.Config, opts ...ExecutorOption) (*tools.ToolsExecutor, error) {
-	toolsExecutor := tools.ToolsExecutor{}
+// Definition returns the function definition with the parameters derived from the Args struct.
+func Definition[Args any](name, description string) llms.FunctionDefinition {
+	return tools.Definition[Args](name, description)
+}
+
+func NewToolsExecutor(ctx context.Context, cfg config.Config, opts ...ExecutorOption) (_ *ToolsExecutor, err error) {
+	toolsExecutor := &tools.ToolsExecutor{}
 	tools := map[string]*tools.ToolData{}
-	options := ExecutorOptions{}
+	options := ExecutorOptions{
+		Policies:           maps.Clone(DefaultToolPolicies),
+		DefaultOutputLimit: cfg.ToolOutputLimit,
+		EagerInit:          cfg.ToolEagerInit,
+		HealthCheck:        cfg.ToolHealthCheck,
+	}
+	if cfg.ToolDescVerbose {
+		options.PromptDescMode = PromptDescVerbose
+	}
+	// Release the already created tools if the executor can not be created
+	defer func() {
+		if err == nil {
+			return
+		}
+		toolsExecutor.Tools = tools
+		if closeErr := toolsExecutor.Close(ctx); closeErr != nil {
+			log.Warn().Err(closeErr).Msg("tools cleanup")
+		}
+	}()
 
 	for _, opt := range opts {
 		opt(&options)
 	}
+	whitelisted := func(name string) bool {
+		return len(options.ToolsWhitelist) == 0 ||
+			slices.Contains(options.ToolsWhitelist, name)
+	}
+	overridden := func(name string) bool {
+		return slices.ContainsFunc(options.OverrideTools, func(tool *ToolData) bool {
+			return tool.Definition.Name == name
+		})
+	}
 
-	for _, toolInit := range globalToolsRegistry {
-		tool, err := toolInit(ctx, cfg)
+	globalToolsRegistryMu.RLock()
+	registry := slices.Clone(globalToolsRegistry)
+	globalToolsRegistryMu.RUnlock()
+
+	for _, entry := range registry {
+		if entry.provider != nil {
+			providerCtx := context.WithValue(ctx, toolsWhitelistKey{}, options.ToolsWhitelist)
+			providedTools, err := entry.provider(providerCtx, cfg, toolsExecutor)
+			if err != nil {
+				return nil, fmt.Errorf("init tools provider %s: %w", entry.name, err)
+			}
+			skipped, kept := []*ToolData{}, false
+			for _, tool := range providedTools {
+				if overridden(tool.Definition.Name) ||
+					!whitelisted(entry.name) && !whitelisted(tool.Definition.Name) {
+					skipped = append(skipped, tool)
+					continue
+				}
+				if _, ok := tools[tool.Definition.Name]; ok {
+					return nil, fmt.Errorf("%w: %s", ErrDuplicateTool, tool.Definition.Name)
+				}
+				tools[tool.Definition.Name] = tool
+				kept = true
+			}
+			// The skipped tools can share the resources with the kept ones, e.g. the MCP server session,
+			// so they are only released if none of the provider tools is kept
+			if !kept {
+				for _, tool := range skipped {
+					if err := tool.Release(ctx); err != nil {
+						log.Warn().Err(err).Msgf("skipped tool %s cleanup", tool.Definition.Name)
+					}
+				}
+			}
+			continue
+		}
+		if !whitelisted(entry.name) || overridden(entry.name) {
+			continue
+		}
+
+		tool, err := entry.factory(ctx, cfg, toolsExecutor)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("init tool %s: %w", entry.name, err)
 		}
 		if tool == nil {
 			continue
 		}
+		if tool.Definition.Name != entry.name {
+			log.Warn().Msgf("tool registered as %s is named %s", entry.name, tool.Definition.Name)
+		}
 
-		if len(options.ToolsWhitelist) > 0 &&
-			!slices.Contains(
-				options.ToolsWhitelist,
-				tool.Definition.Name,
-			) {
+		if !whitelisted(tool.Definition.Name) {
 			continue
 		}
+		if _, ok := tools[tool.Definition.Name]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateTool, tool.Definition.Name)
+		}
 
 		tools[tool.Definition.Name] = tool
 	}
+
+	for _, tool := range options.Tools {
+		if !whitelisted(tool.Definition.Name) {
+			continue
+		}
+		if _, ok := tools[tool.Definition.Name]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateTool, tool.Definition.Name)
+		}
+		tools[tool.Definition.Name] = tool
+	}
+	for _, tool := range options.OverrideTools {
+		if !whitelisted(tool.Definition.Name) {
+			continue
+		}
+		tools[tool.Definition.Name] = tool
+	}
+	if options.Audit == nil {
+		auditLog, err := configAuditLog(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		options.Audit = auditLog
+	}
+
+	if options.Cache == nil {
+		cache, err := configToolCache(cfg)
+		if err != nil {
+			return nil, err
+		}
+		options.Cache = cache
+	}
+
+	if options.CallPolicy == nil && cfg.ToolPolicyFile != "" {
+		callPolicy, err := LoadCallPolicy(cfg.ToolPolicyFile)
+		if err != nil {
+			return nil, err
+		}
+		options.CallPolicy = callPolicy
+	}
+	if options.CallPolicy != nil {
+		// The caller policy is not changed by the compilation and the config dry run
+		options.CallPolicy = options.CallPolicy.Clone()
+		if err := options.CallPolicy.Compile(); err != nil {
+			return nil, err
+		}
+		if cfg.ToolPolicyDryRun {
+			options.CallPolicy.DryRun = true
+		}
+	}
+
 	toolsExecutor.Tools = tools
+	toolsExecutor.Audit = options.Audit
+	toolsExecutor.CallPolicy = options.CallPolicy
+	toolsExecutor.Approver = options.Approver
+	toolsExecutor.Cache = options.Cache
+	toolsExecutor.PromptDescMode = options.PromptDescMode
+	toolsExecutor.Policies = options.Policies
+	toolsExecutor.DefaultPolicy = options.DefaultPolicy
+	toolsExecutor.OutputLimits = options.OutputLimits
+	toolsExecutor.DefaultOutputLimit = options.DefaultOutputLimit
 
-	globalToolsExecutor = &toolsExecutor
+	outputLimited := options.DefaultOutputLimit > 0
+	for _, limit := range options.OutputLimits {
+		outputLimited = outputLimited || limit > 0
+	}
+	if outputLimited {
+		readMoreTool := toolsExecutor.ReadMoreTool()
+		if _, ok := tools[readMoreTool.Definition.Name]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateTool, readMoreTool.Definition.Name)
+		}
+		tools[readMoreTool.Definition.Name] = readMoreTool
+	}
 
-	return &toolsExecutor, nil
+	toolsExecutor.Setup(ctx, SetupOptions{
+		EagerInit:   options.EagerInit,
+		HealthCheck: options.HealthCheck,
+	})
+
+	return toolsExecutor, nil
 }
 
 func WithToolsWhitelist(tool ...string) ExecutorOption {
@@ -57,3 +399,79 @@ func WithToolsWhitelist(tool ...string) ExecutorOption {
 		eo.ToolsWhitelist = append(eo.ToolsWhitelist, tool...)
 	}
 }
+
+// WithTools adds the tool instances to the executor, ErrDuplicateTool is returned if a name is taken.
+func WithTools(tool ...*ToolData) ExecutorOption {
+	return func(eo *ExecutorOptions) {
+		eo.Tools = append(eo.Tools, tool...)
+	}
+}
+
+// WithToolsOverride adds the tool instances to the executor, replacing the registered tools with the same names.
+func WithToolsOverride(tool ...*ToolData) ExecutorOption {
+	return func(eo *ExecutorOptions) {
+		eo.OverrideTools = append(eo.OverrideTools, tool...)
+	}
+}
+
+// WithToolPolicy sets the execution policy of the tool: timeout, retries and circuit breaker.
+func WithToolPolicy(toolName string, policy ExecutionPolicy) ExecutorOption {
+	return func(eo *ExecutorOptions) {
+		if eo.Policies == nil {
+			eo.Policies = map[string]ExecutionPolicy{}
+		}
+		eo.Policies[toolName] = policy
+	}
+}
+
+// WithDefaultToolPolicy sets the execution policy of the tools without their own one.
+func WithDefaultToolPolicy(policy ExecutionPolicy) ExecutorOption {
+	return func(eo *ExecutorOptions) {
+		eo.DefaultPolicy = policy
+	}
+}
+
+// WithToolOutputLimit sets the tool output size limit in bytes, zero disables the limit for the tool.
+func WithToolOutputLimit(toolName string, limit int) ExecutorOption {
+	return func(eo *ExecutorOptions) {
+		if eo.OutputLimits == nil {
+			eo.OutputLimits = map[string]int{}
+		}
+		eo.OutputLimits[toolName] = limit
+	}
+}
+
+// WithDefaultToolOutputLimit sets the output size limit in bytes of the tools without their own one.
+func WithDefaultToolOutputLimit(limit int) ExecutorOption {
+	return func(eo *ExecutorOptions) {
+		eo.DefaultOutputLimit = limit
+	}
+}
+
+// WithAuditLog sets the audit log recording every call of the executor.
+func WithAuditLog(auditLog *AuditLog) ExecutorOption {
+	return func(eo *ExecutorOptions) {
+		eo.Audit = auditLog
+	}
+}
+
+// WithEagerInit initializes the tools on the executor creation, disabling the failed ones.
+func WithEagerInit() ExecutorOption {
+	return func(eo *ExecutorOptions) {
+		eo.EagerInit = true
+	}
+}
+
+// WithHealthCheck checks the tools health on the executor creation, disabling the unhealthy ones.
+func WithHealthCheck() ExecutorOption {
+	return func(eo *ExecutorOptions) {
+		eo.HealthCheck = true
+	}
+}
+
+// WithPromptDescMode sets the tools prompt parameters rendering mode, compact or verbose.
+func WithPromptDescMode(mode PromptDescMode) ExecutorOption {
+	return func(eo *ExecutorOptions) {
+		eo.PromptDescMode = mode
+	}
+}